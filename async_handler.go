@@ -0,0 +1,290 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ Handler = (*AsyncHandler)(nil)
+	_ Syncer  = (*AsyncHandler)(nil)
+	_ Closer  = (*AsyncHandler)(nil)
+)
+
+// OverflowPolicy decides what AsyncHandler does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the entry being logged.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest queued entry to make room.
+	OverflowDropOldest
+	// OverflowSample waits for room for one in every SampleRate entries and
+	// discards the others.
+	OverflowSample
+)
+
+type (
+	// AsyncHandler queues entries and passes them to the wrapped handler from a
+	// background goroutine, so slow handlers don't block the caller. A wrapped
+	// BatchHandler gets the entries in batches, other handlers get each entry
+	// once it is dequeued. Entries at PANIC or above are written synchronously
+	// after draining the queue.
+	AsyncHandler struct {
+		next          Handler
+		queueSize     int
+		batchSize     int
+		flushInterval time.Duration
+		policy        OverflowPolicy
+		sampleRate    uint64
+
+		queue    chan BatchEntry
+		flushReq chan chan struct{}
+		done     chan struct{}
+
+		mu        sync.RWMutex
+		closed    bool
+		overflows uint64
+		dropped   uint64
+	}
+
+	AsyncOption func(*AsyncHandler)
+)
+
+func WithQueueSize(size int) AsyncOption {
+	return func(h *AsyncHandler) {
+		h.queueSize = size
+	}
+}
+
+// WithBatchSize sets how many entries a BatchHandler gets at most in a batch,
+// 64 by default.
+func WithBatchSize(size int) AsyncOption {
+	return func(h *AsyncHandler) {
+		h.batchSize = size
+	}
+}
+
+// WithFlushInterval sets how long a partial batch for a BatchHandler waits at
+// most, 1s by default and when interval isn't positive.
+func WithFlushInterval(interval time.Duration) AsyncOption {
+	return func(h *AsyncHandler) {
+		h.flushInterval = interval
+	}
+}
+
+func WithOverflowPolicy(policy OverflowPolicy) AsyncOption {
+	return func(h *AsyncHandler) {
+		h.policy = policy
+	}
+}
+
+// WithSampleRate sets how many overflowing entries share one kept entry under
+// OverflowSample.
+func WithSampleRate(rate int) AsyncOption {
+	return func(h *AsyncHandler) {
+		h.sampleRate = uint64(rate)
+	}
+}
+
+func NewAsyncHandler(next Handler, options ...AsyncOption) *AsyncHandler {
+	h := &AsyncHandler{
+		next:          next,
+		queueSize:     1024,
+		batchSize:     64,
+		flushInterval: time.Second,
+		policy:        OverflowBlock,
+		sampleRate:    10,
+	}
+	for _, o := range options {
+		o(h)
+	}
+	if h.queueSize < 1 {
+		h.queueSize = 1
+	}
+	if h.batchSize < 1 {
+		h.batchSize = 1
+	}
+	if h.sampleRate < 1 {
+		h.sampleRate = 1
+	}
+	if h.flushInterval <= 0 {
+		h.flushInterval = time.Second
+	}
+	h.queue = make(chan BatchEntry, h.queueSize)
+	h.flushReq = make(chan chan struct{})
+	h.done = make(chan struct{})
+	go h.run()
+	return h
+}
+
+func (h *AsyncHandler) Log(ctx context.Context, params Params) {
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		h.next.Log(ctx, params)
+		return
+	}
+	if params.Level >= PANIC {
+		h.mu.RUnlock()
+		h.Flush()
+		h.next.Log(ctx, params)
+		return
+	}
+	defer h.mu.RUnlock()
+
+	e := BatchEntry{Ctx: ctx, Params: params.Clone()}
+	select {
+	case h.queue <- e:
+		return
+	default:
+	}
+
+	switch h.policy {
+	case OverflowDropNewest:
+		atomic.AddUint64(&h.dropped, 1)
+	case OverflowDropOldest:
+		for {
+			select {
+			case h.queue <- e:
+				return
+			default:
+			}
+			select {
+			case <-h.queue:
+				atomic.AddUint64(&h.dropped, 1)
+			default:
+			}
+		}
+	case OverflowSample:
+		if atomic.AddUint64(&h.overflows, 1)%h.sampleRate != 0 {
+			atomic.AddUint64(&h.dropped, 1)
+			return
+		}
+		h.queue <- e
+	default:
+		h.queue <- e
+	}
+}
+
+// Dropped returns the number of entries discarded by the overflow policy.
+func (h *AsyncHandler) Dropped() uint64 {
+	return atomic.LoadUint64(&h.dropped)
+}
+
+// Flush blocks until every entry queued before the call has been handled.
+func (h *AsyncHandler) Flush() {
+	ack := make(chan struct{})
+	select {
+	case h.flushReq <- ack:
+		<-ack
+	case <-h.done:
+	}
+}
+
+// Sync flushes the queue and then syncs the wrapped handler.
+func (h *AsyncHandler) Sync() error {
+	h.Flush()
+	if s, ok := h.next.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close drains the queue, stops the background goroutine and closes the
+// wrapped handler. Entries logged after Close are passed to the wrapped
+// handler synchronously.
+func (h *AsyncHandler) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		<-h.done
+		return nil
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+	<-h.done
+
+	switch c := h.next.(type) {
+	case Closer:
+		return c.Close()
+	case Syncer:
+		return c.Sync()
+	}
+	return nil
+}
+
+func (h *AsyncHandler) run() {
+	defer close(h.done)
+
+	// only a BatchHandler waits for a batch to fill up
+	next, batching := h.next.(BatchHandler)
+	var tick <-chan time.Time
+	if batching {
+		ticker := time.NewTicker(h.flushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	batch := make([]BatchEntry, 0, h.batchSize)
+	write := func() {
+		if batching {
+			// a flush drains the whole queue, more than a batch
+			for i := 0; i < len(batch); i += h.batchSize {
+				end := i + h.batchSize
+				if end > len(batch) {
+					end = len(batch)
+				}
+				next.LogBatch(batch[i:end])
+			}
+		} else {
+			for _, e := range batch {
+				h.next.Log(e.Ctx, e.Params)
+			}
+		}
+		for i := range batch {
+			batch[i] = BatchEntry{}
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-h.queue:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, e)
+			if !batching || len(batch) >= h.batchSize {
+				write()
+			}
+		case <-tick:
+			write()
+		case ack := <-h.flushReq:
+			h.drain(&batch)
+			write()
+			close(ack)
+		}
+	}
+}
+
+// drain moves the entries queued when it is called into batch, entries
+// queued meanwhile are left for later so a busy queue can't hold it forever.
+func (h *AsyncHandler) drain(batch *[]BatchEntry) {
+	for n := len(h.queue); n > 0; n-- {
+		select {
+		case e, ok := <-h.queue:
+			if !ok {
+				return
+			}
+			*batch = append(*batch, e)
+		default:
+			return
+		}
+	}
+}
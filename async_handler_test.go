@@ -0,0 +1,176 @@
+package xlog
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockHandler blocks on its first entry until release is closed.
+type blockHandler struct {
+	recordHandler
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockHandler() *blockHandler {
+	return &blockHandler{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (h *blockHandler) Log(ctx context.Context, params Params) {
+	h.once.Do(func() {
+		close(h.started)
+		<-h.release
+	})
+	h.recordHandler.Log(ctx, params)
+}
+
+func infoParams(msg string) Params {
+	return Params{Time: time.Now(), Level: INFO, Args: []interface{}{msg}}
+}
+
+func messages(entries []Params) []string {
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Message()
+	}
+	sort.Strings(msgs)
+	return msgs
+}
+
+func TestAsyncHandlerOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		policy OverflowPolicy
+		// overflowing entries 3 and 4 that wait for room in the queue
+		blocking    []bool
+		wantMsgs    []string
+		wantDropped uint64
+	}{
+		{"block", OverflowBlock, []bool{true, true}, []string{"0", "1", "2", "3", "4"}, 0},
+		{"drop newest", OverflowDropNewest, []bool{false, false}, []string{"0", "1", "2"}, 2},
+		{"drop oldest", OverflowDropOldest, []bool{false, false}, []string{"0", "3", "4"}, 2},
+		{"sample", OverflowSample, []bool{false, true}, []string{"0", "1", "2", "4"}, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newBlockHandler()
+			h := NewAsyncHandler(next,
+				WithQueueSize(2), WithBatchSize(1), WithOverflowPolicy(tt.policy), WithSampleRate(2))
+			ctx := context.Background()
+
+			// 0 blocks the background goroutine, 1 and 2 fill the queue
+			h.Log(ctx, infoParams("0"))
+			<-next.started
+			h.Log(ctx, infoParams("1"))
+			h.Log(ctx, infoParams("2"))
+			var wg sync.WaitGroup
+			for i, blocking := range tt.blocking {
+				p := infoParams(strconv.Itoa(3 + i))
+				if !blocking {
+					h.Log(ctx, p)
+					continue
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					h.Log(ctx, p)
+				}()
+			}
+			close(next.release)
+			wg.Wait()
+			if err := h.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := messages(next.Entries()); !reflect.DeepEqual(got, tt.wantMsgs) {
+				t.Errorf("entries = %q, want %q", got, tt.wantMsgs)
+			}
+			if got := h.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestAsyncHandlerClose(t *testing.T) {
+	next := &recordHandler{}
+	h := NewAsyncHandler(next, WithBatchSize(100), WithFlushInterval(time.Hour))
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		h.Log(ctx, infoParams(strconv.Itoa(i)))
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(next.Entries()); n != 10 {
+		t.Fatalf("Close wrote %d entries, want the 10 queued", n)
+	}
+	// entries after Close are written synchronously
+	h.Log(ctx, infoParams("late"))
+	if n := len(next.Entries()); n != 11 {
+		t.Errorf("got %d entries after a late one, want 11", n)
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+// batchHandler records the sizes of the batches it gets.
+type batchHandler struct {
+	recordHandler
+	sizesMu sync.Mutex
+	sizes   []int
+}
+
+func (h *batchHandler) LogBatch(entries []BatchEntry) {
+	h.sizesMu.Lock()
+	h.sizes = append(h.sizes, len(entries))
+	h.sizesMu.Unlock()
+	for _, e := range entries {
+		h.recordHandler.Log(e.Ctx, e.Params)
+	}
+}
+
+func (h *batchHandler) Sizes() []int {
+	h.sizesMu.Lock()
+	defer h.sizesMu.Unlock()
+	return append([]int(nil), h.sizes...)
+}
+
+func TestAsyncHandlerBatches(t *testing.T) {
+	next := &batchHandler{}
+	h := NewAsyncHandler(next, WithBatchSize(3), WithFlushInterval(time.Hour))
+	defer h.Close()
+	for i := 0; i < 7; i++ {
+		h.Log(context.Background(), infoParams(strconv.Itoa(i)))
+	}
+	h.Flush()
+
+	if got, want := next.Sizes(), []int{3, 3, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batches = %v, want %v", got, want)
+	}
+}
+
+func TestAsyncHandlerFlushInterval(t *testing.T) {
+	next := &batchHandler{}
+	h := NewAsyncHandler(next, WithBatchSize(100), WithFlushInterval(5*time.Millisecond))
+	defer h.Close()
+
+	h.Log(context.Background(), infoParams("partial batch"))
+	waitEntries(t, &next.recordHandler, 1)
+}
+
+// Handlers that don't take batches get each entry as it is dequeued.
+func TestAsyncHandlerUnbatched(t *testing.T) {
+	next := &recordHandler{}
+	h := NewAsyncHandler(next, WithBatchSize(100), WithFlushInterval(time.Hour))
+	defer h.Close()
+
+	h.Log(context.Background(), infoParams("alone"))
+	waitEntries(t, next, 1)
+}
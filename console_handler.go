@@ -0,0 +1,310 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	_ Handler      = (*ConsoleHandler)(nil)
+	_ BatchHandler = (*ConsoleHandler)(nil)
+	_ Syncer       = (*ConsoleHandler)(nil)
+)
+
+const (
+	consoleLevelWidth  = 5
+	consoleCallerWidth = 24
+)
+
+var consoleLevelNames = map[Level]string{
+	TRACE:   "TRACE",
+	DEBUG:   "DEBUG",
+	INFO:    "INFO",
+	WARNING: "WARN",
+	ERROR:   "ERROR",
+	PANIC:   "PANIC",
+	FATAL:   "FATAL",
+}
+
+var consoleLevelColors = map[Level]string{
+	TRACE:   "\x1b[90m",
+	DEBUG:   "\x1b[35m",
+	INFO:    "\x1b[34m",
+	WARNING: "\x1b[33m",
+	ERROR:   "\x1b[31m",
+	PANIC:   "\x1b[1;31m",
+	FATAL:   "\x1b[1;31m",
+}
+
+const consoleColorReset = "\x1b[0m"
+
+type (
+	// ConsoleHandler writes human-friendly lines for local development:
+	//
+	//	2006-01-02T15:04:05.000Z07:00 INFO  server/main.go:42        listening addr=:8080
+	ConsoleHandler struct {
+		mu         sync.Mutex
+		w          io.Writer
+		color      bool
+		timeFormat string
+	}
+
+	ConsoleOption func(*ConsoleHandler)
+)
+
+// WithColor overrides the terminal detection of NewConsoleHandler.
+func WithColor(enabled bool) ConsoleOption {
+	return func(h *ConsoleHandler) {
+		h.color = enabled
+	}
+}
+
+func WithTimeFormat(layout string) ConsoleOption {
+	return func(h *ConsoleHandler) {
+		h.timeFormat = layout
+	}
+}
+
+// NewConsoleHandler returns a handler writing to w. Colors are enabled when w
+// is a terminal and NO_COLOR isn't set.
+func NewConsoleHandler(w io.Writer, options ...ConsoleOption) *ConsoleHandler {
+	h := &ConsoleHandler{
+		w:          w,
+		color:      isTerminal(w) && os.Getenv("NO_COLOR") == "",
+		timeFormat: "2006-01-02T15:04:05.000Z07:00",
+	}
+	for _, o := range options {
+		o(h)
+	}
+	return h
+}
+
+func (h *ConsoleHandler) Log(ctx context.Context, params Params) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	h.appendConsole(buf, params)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+// LogBatch writes entries with a single Write.
+func (h *ConsoleHandler) LogBatch(entries []BatchEntry) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	for _, e := range entries {
+		h.appendConsole(buf, e.Params)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+func (h *ConsoleHandler) appendConsole(buf *bytes.Buffer, params Params) {
+	t := params.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	buf.WriteString(t.Format(h.timeFormat))
+	buf.WriteByte(' ')
+	h.writeLevel(buf, params.Level)
+	if params.Caller != nil {
+		buf.WriteByte(' ')
+		writePadded(buf, params.Caller.Filename+":"+strconv.Itoa(params.Caller.Line), consoleCallerWidth)
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(params.Message())
+
+	prefix := ""
+	var errStacks [][]errorFrame
+	rangeFields(params.Fields, func(f Field) {
+		if f.Kind == NamespaceKind {
+			prefix += f.Key + "."
+			return
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(prefix)
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteValue(formatValue(f)))
+		if f.Kind != ErrorKind {
+			return
+		}
+		// the fields of an error follow it, its stack comes after the line
+		info := newErrorInfo(f.Interface.(error))
+		keys := make([]string, 0, len(info.Fields))
+		for k := range info.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteByte(' ')
+			buf.WriteString(prefix + f.Key + "." + k)
+			buf.WriteByte('=')
+			buf.WriteString(quoteValue(formatValue(Any(k, info.Fields[k]))))
+		}
+		if len(info.Stack) > 0 {
+			errStacks = append(errStacks, info.Stack)
+		}
+	})
+	buf.WriteByte('\n')
+	// stacks follow the line indented, as in a goroutine trace
+	for _, f := range params.Stack {
+		writeConsoleFrame(buf, f.Function, f.File, f.Line)
+	}
+	for _, stack := range errStacks {
+		buf.WriteString("  caused at:\n")
+		for _, f := range stack {
+			writeConsoleFrame(buf, f.Func, f.File, f.Line)
+		}
+	}
+}
+
+// Sync syncs the underlying writer if it supports it.
+func (h *ConsoleHandler) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return syncWriter(h.w)
+}
+
+func (h *ConsoleHandler) writeLevel(buf *bytes.Buffer, level Level) {
+	name, ok := consoleLevelNames[level]
+	if !ok {
+		name = level.String()
+		if len(name) > consoleLevelWidth {
+			name = name[:consoleLevelWidth]
+		}
+	}
+	color := ""
+	if h.color {
+		color, ok = consoleLevelColors[level]
+		if !ok {
+			color = consoleLevelColors[nearestLevel(level)]
+		}
+	}
+	if color != "" {
+		buf.WriteString(color)
+		buf.WriteString(name)
+		buf.WriteString(consoleColorReset)
+		buf.WriteString(strings.Repeat(" ", consoleLevelWidth-len(name)))
+		return
+	}
+	writePadded(buf, name, consoleLevelWidth)
+}
+
+func writeConsoleFrame(buf *bytes.Buffer, function, file string, line int) {
+	buf.WriteString("    ")
+	buf.WriteString(function)
+	buf.WriteString("\n        ")
+	buf.WriteString(file)
+	buf.WriteByte(':')
+	buf.WriteString(strconv.Itoa(line))
+	buf.WriteByte('\n')
+}
+
+func writePadded(buf *bytes.Buffer, s string, width int) {
+	buf.WriteString(s)
+	for i := len(s); i < width; i++ {
+		buf.WriteByte(' ')
+	}
+}
+
+// nearestLevel returns the built-in level at or below level.
+func nearestLevel(level Level) Level {
+	switch {
+	case level >= FATAL:
+		return FATAL
+	case level >= PANIC:
+		return PANIC
+	case level >= ERROR:
+		return ERROR
+	case level >= WARNING:
+		return WARNING
+	case level >= INFO:
+		return INFO
+	case level >= DEBUG:
+		return DEBUG
+	default:
+		return TRACE
+	}
+}
+
+// formatValue renders a field value as plain text.
+func formatValue(f Field) string {
+	switch f.Kind {
+	case StringKind:
+		return f.Str
+	case IntKind:
+		return strconv.FormatInt(f.Integer, 10)
+	case UintKind:
+		return strconv.FormatUint(uint64(f.Integer), 10)
+	case BoolKind:
+		return strconv.FormatBool(f.Integer == 1)
+	case TimeKind:
+		return f.Interface.(time.Time).Format(time.RFC3339Nano)
+	case ErrorKind:
+		return f.Interface.(error).Error()
+	case ObjectKind:
+		return fmt.Sprintf("%+v", f.Interface)
+	default:
+		return fmt.Sprint(f.Value())
+	}
+}
+
+// quoteValue quotes s if it is empty or contains spaces, quotes, equals signs
+// or control characters.
+func quoteValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f || r == utf8.RuneError {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// syncWriter syncs w if it can be synced. Files other than regular ones are
+// skipped, fsync fails with EINVAL for terminals and pipes.
+func syncWriter(w io.Writer) error {
+	if f, ok := w.(*os.File); ok {
+		fi, err := f.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+	}
+	if s, ok := w.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,27 @@
+package xlog
+
+import "context"
+
+type contextFieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields. Fields attached by enclosing
+// calls are kept and the new ones are appended after them.
+func WithFields(ctx context.Context, fields ...interface{}) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	prev := FieldsFromContext(ctx)
+	merged := make([]interface{}, 0, len(prev)+len(fields))
+	merged = append(merged, prev...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+// FieldsFromContext returns the fields attached to ctx by WithFields.
+func FieldsFromContext(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(contextFieldsKey{}).([]interface{})
+	return fields
+}
@@ -0,0 +1,208 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	_ Handler = (*DedupHandler)(nil)
+	_ Syncer  = (*DedupHandler)(nil)
+	_ Closer  = (*DedupHandler)(nil)
+)
+
+// DedupMode decides which entries DedupHandler compares.
+type DedupMode int
+
+const (
+	// DedupConsecutive swallows an entry equal to the previous one.
+	DedupConsecutive DedupMode = iota
+	// DedupWindow swallows an entry equal to any entry first seen less than
+	// the window ago.
+	DedupWindow
+)
+
+// maxDedupRuns bounds the entries a DedupWindow handler remembers, the ones
+// without repeats are forgotten beyond it.
+const maxDedupRuns = 4096
+
+type (
+	// DedupHandler passes the first of a run of equal entries to the wrapped
+	// handler and swallows the repeats. Entries are equal if they have the same
+	// Level, Format, Args and Fields. When the run ends, because another entry
+	// comes in DedupConsecutive mode or because the window elapses, the entry
+	// is written once more with the fields repeated, first_seen and
+	// last_seen. Entries at PANIC or above are never swallowed.
+	DedupHandler struct {
+		next   Handler
+		mode   DedupMode
+		window time.Duration
+
+		mu   sync.Mutex
+		runs map[string]*dedupRun
+	}
+
+	DedupOption func(*DedupHandler)
+
+	dedupRun struct {
+		first    time.Time
+		last     time.Time
+		repeated int64
+		ctx      context.Context
+		params   Params
+		timer    *time.Timer
+	}
+)
+
+func WithDedupMode(mode DedupMode) DedupOption {
+	return func(h *DedupHandler) {
+		h.mode = mode
+	}
+}
+
+// WithDedupWindow sets how long a run lasts at most, 10s by default.
+func WithDedupWindow(window time.Duration) DedupOption {
+	return func(h *DedupHandler) {
+		h.window = window
+	}
+}
+
+func NewDedupHandler(next Handler, options ...DedupOption) *DedupHandler {
+	h := &DedupHandler{
+		next:   next,
+		mode:   DedupConsecutive,
+		window: 10 * time.Second,
+		runs:   make(map[string]*dedupRun),
+	}
+	for _, o := range options {
+		o(h)
+	}
+	if h.window <= 0 {
+		h.window = 10 * time.Second
+	}
+	return h
+}
+
+func (h *DedupHandler) Log(ctx context.Context, params Params) {
+	if params.Level >= PANIC {
+		h.mu.Lock()
+		h.endAll()
+		h.mu.Unlock()
+		h.next.Log(ctx, params)
+		return
+	}
+	key := dedupKey(params)
+	now := params.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.runs[key]
+	if r != nil && now.Sub(r.first) < h.window {
+		if r.repeated == 0 {
+			r.ctx = ctx
+			r.params = params.Clone()
+			r.timer = time.AfterFunc(r.first.Add(h.window).Sub(now), func() {
+				h.mu.Lock()
+				defer h.mu.Unlock()
+				if h.runs[key] == r {
+					h.end(key)
+				}
+			})
+		}
+		r.repeated++
+		r.last = now
+		return
+	}
+	if r != nil {
+		h.end(key)
+	}
+	if h.mode == DedupConsecutive {
+		h.endAll()
+	} else if len(h.runs) >= maxDedupRuns {
+		for k, r := range h.runs {
+			if r.repeated == 0 {
+				delete(h.runs, k)
+			}
+		}
+	}
+	h.runs[key] = &dedupRun{first: now, last: now}
+	h.next.Log(ctx, params)
+}
+
+// Sync writes the pending repeat summaries and syncs the wrapped handler.
+func (h *DedupHandler) Sync() error {
+	h.mu.Lock()
+	h.endAll()
+	h.mu.Unlock()
+	if s, ok := h.next.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+func (h *DedupHandler) Close() error {
+	h.mu.Lock()
+	h.endAll()
+	h.mu.Unlock()
+	switch next := h.next.(type) {
+	case Closer:
+		return next.Close()
+	case Syncer:
+		return next.Sync()
+	}
+	return nil
+}
+
+func (h *DedupHandler) endAll() {
+	for key := range h.runs {
+		h.end(key)
+	}
+}
+
+// end forgets the run of key and writes its summary if it has repeats. The
+// caller holds h.mu, so a summary is written before any later entry.
+func (h *DedupHandler) end(key string) {
+	r := h.runs[key]
+	delete(h.runs, key)
+	if r.repeated == 0 {
+		return
+	}
+	r.timer.Stop()
+	params := r.params
+	params.Time = r.last
+	params.Fields = append(params.Fields,
+		Int64("repeated", r.repeated),
+		Time("first_seen", r.first),
+		Time("last_seen", r.last),
+	)
+	h.next.Log(r.ctx, params)
+}
+
+// dedupKey encodes what makes two entries equal.
+func dedupKey(params Params) string {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	buf.WriteString(strconv.Itoa(int(params.Level)))
+	if params.Format != nil {
+		buf.WriteString("\x00f")
+		buf.WriteString(*params.Format)
+	}
+	for _, arg := range params.Args {
+		fmt.Fprintf(buf, "\x00a%#v", arg)
+	}
+	rangeFields(params.Fields, func(f Field) {
+		fmt.Fprintf(buf, "\x00%d:%s=%s", f.Kind, f.Key, formatValue(f))
+	})
+	return buf.String()
+}
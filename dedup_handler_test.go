@@ -0,0 +1,74 @@
+package xlog
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDedupConsecutive(t *testing.T) {
+	next := &recordHandler{}
+	h := NewDedupHandler(next)
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		h.Log(ctx, Params{Time: start.Add(time.Duration(i) * time.Millisecond), Level: INFO, Args: []interface{}{"retrying"}})
+	}
+	h.Log(ctx, Params{Time: start.Add(3 * time.Millisecond), Level: INFO, Args: []interface{}{"connected"}})
+
+	entries := next.Entries()
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Message())
+	}
+	if want := []string{"retrying", "retrying", "connected"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("entries = %q, want %q", got, want)
+	}
+	sum := entries[1]
+	if got := fieldValue(sum, "repeated"); got != int64(2) {
+		t.Errorf("repeated = %v, want 2", got)
+	}
+	if got, _ := fieldValue(sum, "first_seen").(time.Time); !got.Equal(start) {
+		t.Errorf("first_seen = %v, want %v", got, start)
+	}
+	if got, _ := fieldValue(sum, "last_seen").(time.Time); !got.Equal(start.Add(2 * time.Millisecond)) {
+		t.Errorf("last_seen = %v, want %v", got, start.Add(2*time.Millisecond))
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	next := &recordHandler{}
+	h := NewDedupHandler(next, WithDedupMode(DedupWindow), WithDedupWindow(10*time.Millisecond))
+	defer h.Close()
+	ctx := context.Background()
+	for _, msg := range []string{"a", "b", "a", "a"} {
+		h.Log(ctx, Params{Level: INFO, Args: []interface{}{msg}})
+	}
+
+	// the summary of a is written by the timer once the window elapses
+	entries := waitEntries(t, next, 3)
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want a, b and the summary of a", len(entries))
+	}
+	if sum := entries[2]; sum.Message() != "a" || fieldValue(sum, "repeated") != int64(2) {
+		t.Errorf("summary = %q repeated=%v, want a repeated=2", sum.Message(), fieldValue(sum, "repeated"))
+	}
+}
+
+func TestDedupClose(t *testing.T) {
+	next := &recordHandler{}
+	h := NewDedupHandler(next, WithDedupMode(DedupWindow), WithDedupWindow(time.Hour))
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		h.Log(ctx, Params{Level: ERROR, Args: []interface{}{"timeout"}})
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := next.Entries()
+	if len(entries) != 2 || fieldValue(entries[1], "repeated") != int64(1) {
+		t.Fatalf("entries = %+v, want timeout and its summary written by Close", entries)
+	}
+}
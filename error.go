@@ -0,0 +1,185 @@
+package xlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// maxErrorChain bounds the causes walked for an error, in case of cycles such
+// as a Cause method returning its own error.
+const maxErrorChain = 32
+
+type (
+	// fieldsError is the error returned by WrapErr.
+	fieldsError struct {
+		err    error
+		fields []interface{}
+		stack  []Caller
+	}
+
+	// errorInfo is what handlers write for an Err field.
+	errorInfo struct {
+		Msg    string                 `json:"msg"`
+		Type   string                 `json:"type"`
+		Chain  []errorCause           `json:"chain,omitempty"`
+		Fields map[string]interface{} `json:"fields,omitempty"`
+		Stack  []errorFrame           `json:"stack,omitempty"`
+	}
+
+	errorCause struct {
+		Msg  string `json:"msg"`
+		Type string `json:"type"`
+	}
+
+	errorFrame struct {
+		Func string `json:"func"`
+		File string `json:"file"`
+		Line int    `json:"line"`
+	}
+)
+
+// WrapErr attaches fields to err, they are logged with it by Err. The stack of
+// the call is recorded too unless an error of the chain already carries one.
+// The result unwraps to err, a nil err gives nil.
+func WrapErr(err error, fields ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	e := &fieldsError{err: err, fields: fields}
+	for _, c := range errorChain(err) {
+		if errorStack(c) != nil {
+			return e
+		}
+	}
+	e.stack = captureStack(1, defaultStackDepth)
+	return e
+}
+
+func (e *fieldsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *fieldsError) Unwrap() error {
+	return e.err
+}
+
+// Format keeps the verbose forms of the wrapped error, e.g. %+v of errors
+// with stacks.
+func (e *fieldsError) Format(s fmt.State, verb rune) {
+	if f, ok := e.err.(fmt.Formatter); ok {
+		f.Format(s, verb)
+		return
+	}
+	if verb == 'q' {
+		fmt.Fprintf(s, "%q", e.err.Error())
+		return
+	}
+	io.WriteString(s, e.err.Error())
+}
+
+// newErrorInfo describes err with its causes, the fields of the WrapErr calls
+// in its chain, outer ones winning, and the deepest stack it carries.
+func newErrorInfo(err error) errorInfo {
+	if e, ok := err.(*redactedError); ok {
+		return e.info
+	}
+	info := errorInfo{Msg: err.Error(), Type: errorType(err)}
+	chain := errorChain(err)
+	first := true
+	for _, e := range chain {
+		if _, ok := e.(*fieldsError); ok {
+			continue
+		}
+		// the outermost error is the one described by Msg and Type
+		if first {
+			first = false
+			continue
+		}
+		info.Chain = append(info.Chain, errorCause{Msg: e.Error(), Type: errorType(e)})
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		e, ok := chain[i].(*fieldsError)
+		if !ok {
+			continue
+		}
+		rangeFields(e.fields, func(f Field) {
+			if f.Kind == NamespaceKind {
+				return
+			}
+			if info.Fields == nil {
+				info.Fields = make(map[string]interface{})
+			}
+			info.Fields[f.Key] = f.Value()
+		})
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if stack := errorStack(chain[i]); stack != nil {
+			for _, f := range stack {
+				info.Stack = append(info.Stack, errorFrame{Func: f.Function, File: f.File, Line: f.Line})
+			}
+			break
+		}
+	}
+	return info
+}
+
+// errorChain returns err and its causes outermost first, following Unwrap and
+// the Cause method of github.com/pkg/errors. Errors with Unwrap() []error are
+// walked depth first.
+func errorChain(err error) []error {
+	var chain []error
+	var walk func(err error)
+	walk = func(err error) {
+		for err != nil && len(chain) < maxErrorChain {
+			chain = append(chain, err)
+			switch e := err.(type) {
+			case interface{ Unwrap() []error }:
+				for _, e := range e.Unwrap() {
+					walk(e)
+				}
+				return
+			case interface{ Cause() error }:
+				err = e.Cause()
+			default:
+				err = errors.Unwrap(err)
+			}
+		}
+	}
+	walk(err)
+	return chain
+}
+
+func errorType(err error) string {
+	if e, ok := err.(*fieldsError); ok {
+		return errorType(e.err)
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// errorStack returns the stack err itself carries: the one of WrapErr,
+// StackTrace() of github.com/pkg/errors and alike, whose frames are program
+// counters, or Callers() []uintptr.
+func errorStack(err error) []Caller {
+	switch e := err.(type) {
+	case *fieldsError:
+		return e.stack
+	case interface{ Callers() []uintptr }:
+		return framesFromPCs(e.Callers(), defaultStackDepth)
+	}
+	m := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+		return nil
+	}
+	t := m.Type().Out(0)
+	if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	frames := m.Call(nil)[0]
+	pcs := make([]uintptr, frames.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(frames.Index(i).Uint())
+	}
+	return framesFromPCs(pcs, defaultStackDepth)
+}
@@ -0,0 +1,210 @@
+package xlog
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// BadKey is used for values in Params.Fields that don't have a string key.
+const BadKey = "!BADKEY"
+
+// FieldKind tells how a Field stores its value.
+type FieldKind uint8
+
+const (
+	AnyKind FieldKind = iota
+	StringKind
+	IntKind
+	UintKind
+	FloatKind
+	BoolKind
+	DurationKind
+	TimeKind
+	ErrorKind
+	StringerKind
+	ObjectKind
+	NamespaceKind
+)
+
+// Field is a strongly typed key/value pair. Scalars are kept in Integer or
+// Str, everything else in Interface.
+type Field struct {
+	Key       string
+	Kind      FieldKind
+	Integer   int64
+	Str       string
+	Interface interface{}
+}
+
+func String(key string, val string) Field {
+	return Field{Key: key, Kind: StringKind, Str: val}
+}
+
+func Int(key string, val int) Field {
+	return Int64(key, int64(val))
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Kind: IntKind, Integer: val}
+}
+
+func Uint(key string, val uint) Field {
+	return Uint64(key, uint64(val))
+}
+
+func Uint64(key string, val uint64) Field {
+	return Field{Key: key, Kind: UintKind, Integer: int64(val)}
+}
+
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Kind: FloatKind, Integer: int64(math.Float64bits(val))}
+}
+
+func Bool(key string, val bool) Field {
+	var i int64
+	if val {
+		i = 1
+	}
+	return Field{Key: key, Kind: BoolKind, Integer: i}
+}
+
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Kind: DurationKind, Integer: int64(val)}
+}
+
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, Kind: TimeKind, Interface: val}
+}
+
+// Err adds err under the "error" key. Handlers write it as an object with its
+// message and type, the causes found through Unwrap, the fields attached with
+// WrapErr and the stack the error carries.
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+func NamedErr(key string, err error) Field {
+	if err == nil {
+		return Field{Key: key, Kind: AnyKind}
+	}
+	return Field{Key: key, Kind: ErrorKind, Interface: err}
+}
+
+func Stringer(key string, val fmt.Stringer) Field {
+	return Field{Key: key, Kind: StringerKind, Interface: val}
+}
+
+// Object adds a nested value such as a struct or map, handlers that support it
+// render it as structured data.
+func Object(key string, val interface{}) Field {
+	return Field{Key: key, Kind: ObjectKind, Interface: val}
+}
+
+// Namespace nests all following fields of the entry under key.
+func Namespace(key string) Field {
+	return Field{Key: key, Kind: NamespaceKind}
+}
+
+// Any picks the best typed constructor for val. A Field val is logged under
+// key instead of its own.
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case Field:
+		v.Key = key
+		return v
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint(key, v)
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case float64:
+		return Float64(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return NamedErr(key, v)
+	case fmt.Stringer:
+		return Stringer(key, v)
+	default:
+		return Field{Key: key, Kind: AnyKind, Interface: val}
+	}
+}
+
+// Value returns the field's value as a plain Go value.
+func (f Field) Value() interface{} {
+	switch f.Kind {
+	case StringKind:
+		return f.Str
+	case IntKind:
+		return f.Integer
+	case UintKind:
+		return uint64(f.Integer)
+	case FloatKind:
+		return math.Float64frombits(uint64(f.Integer))
+	case BoolKind:
+		return f.Integer == 1
+	case DurationKind:
+		return time.Duration(f.Integer)
+	default:
+		return f.Interface
+	}
+}
+
+// ToFields converts loose Params.Fields into typed fields. Field values are
+// taken as they are, anything else must be a string key followed by a value.
+// Values without a valid key are kept under BadKey.
+func ToFields(fields []interface{}) []Field {
+	out := make([]Field, 0, len(fields))
+	rangeFields(fields, func(f Field) {
+		out = append(out, f)
+	})
+	return out
+}
+
+// rangeFields calls fn for each field as ToFields would return them, without
+// building the slice.
+func rangeFields(fields []interface{}, fn func(Field)) {
+	for i := 0; i < len(fields); i++ {
+		switch v := fields[i].(type) {
+		case Field:
+			fn(v)
+		case string:
+			if i+1 == len(fields) {
+				fn(String(BadKey, v))
+				break
+			}
+			if _, ok := fields[i+1].(Field); ok {
+				fn(String(BadKey, v))
+				break
+			}
+			fn(Any(v, fields[i+1]))
+			i++
+		default:
+			fn(Any(BadKey, v))
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package xlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnyField(t *testing.T) {
+	f := Any("req", String("id", "1"))
+	if want := String("req", "1"); !reflect.DeepEqual(f, want) {
+		t.Errorf("Any of a Field = %+v, want %+v", f, want)
+	}
+}
@@ -0,0 +1,154 @@
+package xlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	_ http.Handler = (*LevelHandler)(nil)
+)
+
+// LevelHandler is a JSON endpoint that reports or changes logger levels at
+// runtime.
+//
+// GET returns the current level, the logger is selected by the name query
+// parameter and defaults to the global logger:
+//
+//	curl localhost:8080/log/level?name=db
+//	{"name":"db","level":"INFO"}
+//
+// PUT changes the level. With a ttl the previous level is restored once the
+// duration elapses:
+//
+//	curl -X PUT localhost:8080/log/level?name=db -d '{"level":"DEBUG","ttl":"10m"}'
+type LevelHandler struct {
+	mu      sync.Mutex
+	loggers map[string]Logger
+	reverts map[string]*levelRevert
+}
+
+type levelRevert struct {
+	level Level
+	timer *time.Timer
+}
+
+type levelPayload struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+type levelError struct {
+	Error string `json:"error"`
+}
+
+func NewLevelHandler() *LevelHandler {
+	return &LevelHandler{
+		loggers: make(map[string]Logger),
+		reverts: make(map[string]*levelRevert),
+	}
+}
+
+// Register makes logger adjustable under name. The empty name is reserved for
+// the global logger. Loggers created by With share the level of their parent,
+// register a ForkLevel copy to change one on its own:
+//
+//	db := xlog.ForkLevel(xlog.With("component", "db"))
+//	h.Register("db", db)
+func (h *LevelHandler) Register(name string, logger Logger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loggers[name] = logger
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+
+	name := r.URL.Query().Get("name")
+	l, ok := h.lookup(name)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		enc.Encode(levelError{Error: fmt.Sprintf("unknown logger %q", name)})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		enc.Encode(levelPayload{Name: name, Level: l.GetLevel().String()})
+	case http.MethodPut:
+		var req levelPayload
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(levelError{Error: fmt.Sprintf("request body must be well-formed JSON: %v", err)})
+			return
+		}
+		level, err := ParseLevel(req.Level)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(levelError{Error: err.Error()})
+			return
+		}
+		var ttl time.Duration
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				enc.Encode(levelError{Error: fmt.Sprintf("invalid ttl %q", req.TTL)})
+				return
+			}
+			ttl = d
+		}
+		h.setLevel(name, l, level, ttl)
+		enc.Encode(levelPayload{Name: name, Level: level.String(), TTL: req.TTL})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		enc.Encode(levelError{Error: "only GET and PUT are supported"})
+	}
+}
+
+func (h *LevelHandler) lookup(name string) (Logger, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if l, ok := h.loggers[name]; ok {
+		return l, true
+	}
+	if name == "" {
+		return log, true
+	}
+	return nil, false
+}
+
+// setLevel applies level to l. A pending revert is cancelled, but the level it
+// would have restored is kept, so the original level survives repeated PUTs.
+func (h *LevelHandler) setLevel(name string, l Logger, level Level, ttl time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	prev := l.GetLevel()
+	if r, ok := h.reverts[name]; ok {
+		r.timer.Stop()
+		prev = r.level
+		delete(h.reverts, name)
+	}
+	l.SetLevel(level)
+	if ttl <= 0 {
+		return
+	}
+
+	r := &levelRevert{level: prev}
+	r.timer = time.AfterFunc(ttl, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.reverts[name] != r {
+			return
+		}
+		delete(h.reverts, name)
+		l.SetLevel(r.level)
+	})
+	h.reverts[name] = r
+}
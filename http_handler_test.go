@@ -0,0 +1,94 @@
+package xlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveLevel(t *testing.T, h *LevelHandler, method, target, body string) (int, map[string]string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: bad response %q: %v", method, target, rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestLevelHandlerGet(t *testing.T) {
+	useLogger(t, WithLevel(WARNING))
+	h := NewLevelHandler()
+	h.Register("db", NewLogger(WithLevel(TRACE)))
+
+	code, resp := serveLevel(t, h, http.MethodGet, "/", "")
+	if code != http.StatusOK || resp["level"] != "WARNING" {
+		t.Errorf("global: got %d %v", code, resp)
+	}
+	code, resp = serveLevel(t, h, http.MethodGet, "/?name=db", "")
+	if code != http.StatusOK || resp["name"] != "db" || resp["level"] != "TRACE" {
+		t.Errorf("db: got %d %v", code, resp)
+	}
+}
+
+func TestLevelHandlerPut(t *testing.T) {
+	useLogger(t, WithLevel(INFO))
+	db := ForkLevel(With("component", "db"))
+	h := NewLevelHandler()
+	h.Register("db", db)
+
+	code, resp := serveLevel(t, h, http.MethodPut, "/?name=db", `{"level":"debug"}`)
+	if code != http.StatusOK || resp["level"] != "DEBUG" {
+		t.Fatalf("got %d %v", code, resp)
+	}
+	if db.GetLevel() != DEBUG {
+		t.Errorf("db level is %v, want DEBUG", db.GetLevel())
+	}
+	if GetLevel() != INFO {
+		t.Errorf("global level changed to %v", GetLevel())
+	}
+}
+
+func TestLevelHandlerErrors(t *testing.T) {
+	useLogger(t)
+	h := NewLevelHandler()
+	tests := []struct {
+		method, target, body string
+		code                 int
+	}{
+		{http.MethodPut, "/", `{"level":"LOUD"}`, http.StatusBadRequest},
+		{http.MethodPut, "/", `{"level":`, http.StatusBadRequest},
+		{http.MethodPut, "/", `{"level":"INFO","ttl":"soon"}`, http.StatusBadRequest},
+		{http.MethodGet, "/?name=nope", "", http.StatusNotFound},
+		{http.MethodPost, "/", `{"level":"INFO"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		code, resp := serveLevel(t, h, tt.method, tt.target, tt.body)
+		if code != tt.code || resp["error"] == "" {
+			t.Errorf("%s %s %s: got %d %v, want %d", tt.method, tt.target, tt.body, code, resp, tt.code)
+		}
+	}
+}
+
+func TestLevelHandlerTTL(t *testing.T) {
+	useLogger(t, WithLevel(WARNING))
+	h := NewLevelHandler()
+
+	serveLevel(t, h, http.MethodPut, "/", `{"level":"DEBUG","ttl":"50ms"}`)
+	// a second PUT keeps the level to restore
+	serveLevel(t, h, http.MethodPut, "/", `{"level":"TRACE","ttl":"50ms"}`)
+	if GetLevel() != TRACE {
+		t.Fatalf("level is %v, want TRACE", GetLevel())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for GetLevel() != WARNING {
+		if time.Now().After(deadline) {
+			t.Fatalf("level is %v, want WARNING after the ttl", GetLevel())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,294 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	_ Handler      = (*JSONHandler)(nil)
+	_ BatchHandler = (*JSONHandler)(nil)
+	_ Syncer       = (*JSONHandler)(nil)
+)
+
+var jsonLevelNames = map[Level]string{
+	TRACE:   "T",
+	DEBUG:   "D",
+	INFO:    "I",
+	WARNING: "W",
+	ERROR:   "E",
+	PANIC:   "P",
+	FATAL:   "F",
+}
+
+// JSONHandler writes one JSON object per line using only the standard
+// library. The keys match InitDefault: t, l, c and msg come first, followed by
+// the fields in the order they were added.
+type JSONHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONHandler(w io.Writer) *JSONHandler {
+	return &JSONHandler{w: w}
+}
+
+func (h *JSONHandler) Log(ctx context.Context, params Params) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	h.appendJSON(buf, params)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+// LogBatch writes entries with a single Write.
+func (h *JSONHandler) LogBatch(entries []BatchEntry) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	for _, e := range entries {
+		h.appendJSON(buf, e.Params)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+func (h *JSONHandler) appendJSON(buf *bytes.Buffer, params Params) {
+	t := params.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	level, ok := jsonLevelNames[params.Level]
+	if !ok {
+		level = params.Level.String()
+	}
+	buf.WriteString(`{"l":`)
+	appendJSONString(buf, level)
+	buf.WriteString(`,"t":`)
+	appendJSONString(buf, t.Format("2006-01-02T15:04:05.000Z0700"))
+	if params.Caller != nil {
+		buf.WriteString(`,"c":`)
+		appendJSONString(buf, shortCaller(params.Caller))
+	}
+	buf.WriteString(`,"msg":`)
+	appendJSONString(buf, params.Message())
+	if len(params.Stack) > 0 {
+		buf.WriteString(`,"stack":[`)
+		for i, f := range params.Stack {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			appendJSONFrame(buf, f.Function, f.File, f.Line)
+		}
+		buf.WriteByte(']')
+	}
+
+	open, empty := 0, false
+	rangeFields(params.Fields, func(f Field) {
+		if !empty {
+			buf.WriteByte(',')
+		}
+		appendJSONString(buf, f.Key)
+		buf.WriteByte(':')
+		empty = f.Kind == NamespaceKind
+		if empty {
+			buf.WriteByte('{')
+			open++
+			return
+		}
+		appendJSONValue(buf, f)
+	})
+	for ; open > 0; open-- {
+		buf.WriteByte('}')
+	}
+	buf.WriteString("}\n")
+}
+
+func (h *JSONHandler) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return syncWriter(h.w)
+}
+
+// shortCaller formats c like zap's ShortCallerEncoder, as dir/file.go:line.
+func shortCaller(c *Caller) string {
+	dir := filepath.Base(filepath.Dir(c.File))
+	return dir + "/" + filepath.Base(c.File) + ":" + strconv.Itoa(c.Line)
+}
+
+func appendJSONValue(buf *bytes.Buffer, f Field) {
+	switch f.Kind {
+	case StringKind:
+		appendJSONString(buf, f.Str)
+	case IntKind:
+		buf.WriteString(strconv.FormatInt(f.Integer, 10))
+	case UintKind:
+		buf.WriteString(strconv.FormatUint(uint64(f.Integer), 10))
+	case FloatKind:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			appendJSONString(buf, strconv.FormatFloat(v, 'g', -1, 64))
+			return
+		}
+		buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case BoolKind:
+		buf.WriteString(strconv.FormatBool(f.Integer == 1))
+	case DurationKind:
+		// seconds, as zap's production config encodes durations
+		buf.WriteString(strconv.FormatFloat(time.Duration(f.Integer).Seconds(), 'g', -1, 64))
+	case TimeKind:
+		appendJSONString(buf, f.Interface.(time.Time).Format(time.RFC3339Nano))
+	case ErrorKind:
+		appendJSONError(buf, f.Interface.(error))
+	default:
+		appendJSONAny(buf, f.Interface)
+	}
+}
+
+// appendJSONAny writes v with encoding/json. json.Marshaler wins over
+// fmt.Stringer, and values that can't be marshalled fall back to %+v.
+func appendJSONAny(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+		return
+	case json.Marshaler:
+	case error:
+		appendJSONString(buf, v.Error())
+		return
+	case fmt.Stringer:
+		appendJSONString(buf, v.String())
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		appendJSONString(buf, fmt.Sprintf("%+v", v))
+		return
+	}
+	buf.Write(b)
+}
+
+// appendJSONError writes err as an object with its message, type, causes,
+// fields and stack.
+func appendJSONError(buf *bytes.Buffer, err error) {
+	info := newErrorInfo(err)
+	buf.WriteString(`{"msg":`)
+	appendJSONString(buf, info.Msg)
+	buf.WriteString(`,"type":`)
+	appendJSONString(buf, info.Type)
+	if len(info.Chain) > 0 {
+		buf.WriteString(`,"chain":[`)
+		for i, c := range info.Chain {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(`{"msg":`)
+			appendJSONString(buf, c.Msg)
+			buf.WriteString(`,"type":`)
+			appendJSONString(buf, c.Type)
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(']')
+	}
+	if len(info.Fields) > 0 {
+		keys := make([]string, 0, len(info.Fields))
+		for k := range info.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteString(`,"fields":{`)
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			appendJSONString(buf, k)
+			buf.WriteByte(':')
+			appendJSONAny(buf, info.Fields[k])
+		}
+		buf.WriteByte('}')
+	}
+	if len(info.Stack) > 0 {
+		buf.WriteString(`,"stack":[`)
+		for i, f := range info.Stack {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			appendJSONFrame(buf, f.Func, f.File, f.Line)
+		}
+		buf.WriteByte(']')
+	}
+	buf.WriteByte('}')
+}
+
+func appendJSONFrame(buf *bytes.Buffer, function, file string, line int) {
+	buf.WriteString(`{"func":`)
+	appendJSONString(buf, function)
+	buf.WriteString(`,"file":`)
+	appendJSONString(buf, file)
+	buf.WriteString(`,"line":`)
+	buf.WriteString(strconv.Itoa(line))
+	buf.WriteByte('}')
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString writes s as a quoted JSON string. Invalid UTF-8 is replaced
+// with U+FFFD.
+func appendJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c == '\n':
+				buf.WriteString(`\n`)
+			case c == '\r':
+				buf.WriteString(`\r`)
+			case c == '\t':
+				buf.WriteString(`\t`)
+			case c < 0x20:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			default:
+				buf.WriteByte(c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			buf.WriteString(`\u202`)
+			buf.WriteByte(hex[r&0xf])
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,128 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logJSON logs one entry with fields through a JSONHandler and decodes it.
+func logJSON(t *testing.T, msg string, fields ...Field) (map[string]interface{}, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := newLogger(WithHandler(NewJSONHandler(&buf)))
+	l.Infov(context.Background(), Args(msg), Fieldsv(fields...))
+
+	dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		t.Fatalf("%v: %q", err, buf.Bytes())
+	}
+	return m, buf.Bytes()
+}
+
+func TestJSONHandlerStrings(t *testing.T) {
+	for _, tt := range []struct {
+		name, in, want string
+	}{
+		{"quotes", `say "hi" \ bye`, `say "hi" \ bye`},
+		{"control", "a\x00b\x01c\x1fd\x7f", "a\x00b\x01c\x1fd\x7f"},
+		{"whitespace", "a\nb\rc\td", "a\nb\rc\td"},
+		{"invalid utf-8", "a\xffb\xfe\xfdc", "a\ufffdb\ufffd\ufffdc"},
+		{"line separators", "a\u2028b\u2029c", "a\u2028b\u2029c"},
+		{"unicode", "héllo 世界 🙂", "héllo 世界 🙂"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, raw := logJSON(t, tt.in, String("s", tt.in))
+			if m["msg"] != tt.want || m["s"] != tt.want {
+				t.Errorf("msg = %q, s = %q, want %q", m["msg"], m["s"], tt.want)
+			}
+			// one line, and no separators that break JavaScript parsers
+			line := bytes.TrimSuffix(raw, []byte("\n"))
+			if bytes.ContainsAny(line, "\n\r\u2028\u2029") {
+				t.Errorf("raw line %q isn't escaped", raw)
+			}
+		})
+	}
+}
+
+type jsonMarshaler struct{}
+
+func (jsonMarshaler) MarshalJSON() ([]byte, error) { return []byte(`{"marshaled":true}`), nil }
+func (jsonMarshaler) String() string               { return "stringer" }
+
+type stringer struct{}
+
+func (stringer) String() string { return "stringer" }
+
+func TestJSONHandlerValues(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	m, _ := logJSON(t, "values",
+		String("string", "s"),
+		Int("int", -1),
+		Uint64("uint", math.MaxUint64),
+		Float64("float", 1.5),
+		Float64("nan", math.NaN()),
+		Bool("bool", true),
+		Duration("duration", 1500*time.Millisecond),
+		Time("time", at),
+		Err(errors.New("failed")),
+		Stringer("stringer", stringer{}),
+		Any("marshaler", jsonMarshaler{}),
+		Object("object_error", errors.New("as string")),
+		Any("struct", struct{ A int }{1}),
+		Any("nil", nil),
+		Any("chan", make(chan int)),
+	)
+	want := map[string]interface{}{
+		"string":       "s",
+		"int":          json.Number("-1"),
+		"uint":         json.Number("18446744073709551615"),
+		"float":        json.Number("1.5"),
+		"nan":          "NaN",
+		"bool":         true,
+		"duration":     json.Number("1.5"),
+		"time":         "2024-01-02T03:04:05.000000006Z",
+		"error":        map[string]interface{}{"msg": "failed", "type": "*errors.errorString"},
+		"stringer":     "stringer",
+		"marshaler":    map[string]interface{}{"marshaled": true},
+		"object_error": "as string",
+		"struct":       map[string]interface{}{"A": json.Number("1")},
+		"nil":          nil,
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(m[k], v) {
+			t.Errorf("%s = %#v, want %#v", k, m[k], v)
+		}
+	}
+	// values encoding/json can't marshal fall back to %+v
+	if s, _ := m["chan"].(string); !strings.HasPrefix(s, "0x") {
+		t.Errorf("chan = %#v, want its %%+v", m["chan"])
+	}
+}
+
+func TestJSONHandlerNamespaces(t *testing.T) {
+	m, _ := logJSON(t, "nested",
+		Int("top", 0),
+		Namespace("a"), Int("x", 1),
+		Namespace("b"), Int("y", 2),
+		Namespace("empty"),
+	)
+	want := map[string]interface{}{
+		"x": json.Number("1"),
+		"b": map[string]interface{}{
+			"y":     json.Number("2"),
+			"empty": map[string]interface{}{},
+		},
+	}
+	if m["top"] != json.Number("0") || !reflect.DeepEqual(m["a"], want) {
+		t.Errorf("top = %v, a = %v, want %v", m["top"], m["a"], want)
+	}
+}
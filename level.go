@@ -1,18 +1,31 @@
 package xlog
 
-// Level levels
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level levels, the gaps between them leave room for custom levels registered
+// with RegisterLevel.
 type Level int8
 
 const (
-	DEBUG Level = iota - 1
-	INFO
-	WARNING
-	ERROR
-	PANIC
-	FATAL
+	TRACE   Level = -8
+	DEBUG   Level = -4
+	INFO    Level = 0
+	WARNING Level = 4
+	ERROR   Level = 8
+	PANIC   Level = 12
+	FATAL   Level = 16
 )
 
+var levelMu sync.RWMutex
+
 var levelNames = map[Level]string{
+	TRACE:   "TRACE",
 	DEBUG:   "DEBUG",
 	INFO:    "INFO",
 	WARNING: "WARNING",
@@ -21,6 +34,125 @@ var levelNames = map[Level]string{
 	FATAL:   "FATAL",
 }
 
+// levelAliases are accepted by ParseLevel in addition to levelNames.
+var levelAliases = map[string]Level{
+	"WARN": WARNING,
+	"ERR":  ERROR,
+}
+
+// RegisterLevel adds a custom level, e.g. RegisterLevel(INFO+2, "NOTICE"). It
+// should be called during initialization, before the level is logged or parsed.
+func RegisterLevel(level Level, name string) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return fmt.Errorf("xlog: empty level name")
+	}
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	if n, ok := levelNames[level]; ok {
+		return fmt.Errorf("xlog: level %d already registered as %s", level, n)
+	}
+	for lvl, n := range levelNames {
+		if n == name {
+			return fmt.Errorf("xlog: level name %s already registered for %d", name, lvl)
+		}
+	}
+	if _, ok := levelAliases[name]; ok {
+		return fmt.Errorf("xlog: level name %s is reserved", name)
+	}
+	levelNames[level] = name
+	return nil
+}
+
 func (l Level) String() string {
-	return levelNames[l]
+	levelMu.RLock()
+	name, ok := levelNames[l]
+	levelMu.RUnlock()
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("LEVEL(%d)", l)
+}
+
+// ParseLevel parses a case-insensitive level name or alias.
+func ParseLevel(text string) (Level, error) {
+	name := strings.ToUpper(strings.TrimSpace(text))
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	for lvl, n := range levelNames {
+		if n == name {
+			return lvl, nil
+		}
+	}
+	if lvl, ok := levelAliases[name]; ok {
+		return lvl, nil
+	}
+	return 0, fmt.Errorf("xlog: unrecognized level %q", text)
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	levelMu.RLock()
+	name, ok := levelNames[l]
+	levelMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("xlog: unknown level %d", l)
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText parses text like ParseLevel. An empty text is INFO, the zero
+// Level, as configs spelling out level: "" always meant.
+func (l *Level) UnmarshalText(text []byte) error {
+	if l == nil {
+		return fmt.Errorf("xlog: can't unmarshal a nil *Level")
+	}
+	if len(bytes.TrimSpace(text)) == 0 {
+		*l = INFO
+		return nil
+	}
+	lvl, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = lvl
+	return nil
+}
+
+// MarshalYAML and UnmarshalYAML implement the gopkg.in/yaml.v2 interfaces,
+// yaml.v3 and encoding/json use the text methods.
+func (l Level) MarshalYAML() (interface{}, error) {
+	text, err := l.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(text), nil
+}
+
+func (l *Level) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var text string
+	if err := unmarshal(&text); err != nil {
+		return err
+	}
+	return l.UnmarshalText([]byte(text))
+}
+
+func (l Level) Enabled(lvl Level) bool {
+	return lvl >= l
+}
+
+// levelVar is a Level that can be read and changed concurrently.
+type levelVar struct {
+	v int32
+}
+
+func newLevelVar(l Level) *levelVar {
+	return &levelVar{v: int32(l)}
+}
+
+func (v *levelVar) Load() Level {
+	return Level(atomic.LoadInt32(&v.v))
+}
+
+func (v *levelVar) Store(l Level) {
+	atomic.StoreInt32(&v.v, int32(l))
 }
@@ -0,0 +1,30 @@
+package xlog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLevelUnmarshalJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Level
+		wantErr bool
+	}{
+		{`"warning"`, WARNING, false},
+		{`"WARN"`, WARNING, false},
+		{`""`, INFO, false},
+		{`" "`, INFO, false},
+		{`"warnig"`, 0, true},
+	} {
+		cfg := Config{Level: ERROR}
+		err := json.Unmarshal([]byte(`{"level":`+tt.in+`}`), &cfg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unmarshal %s: err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && cfg.Level != tt.want {
+			t.Errorf("unmarshal %s = %v, want %v", tt.in, cfg.Level, tt.want)
+		}
+	}
+}
@@ -2,87 +2,160 @@ package xlog
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"io"
 	"strings"
-
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var log = &logger{}
+// log is kept as the concrete type so that calls through the package-level
+// functions can be inlined and their arguments don't escape when disabled.
+var log = newLogger()
 
 type Config struct {
 	Path       string `yaml:"path" json:"path"`
-	Level      string `yaml:"level" json:"level"`
+	Level      Level  `yaml:"level" json:"level"`
 	MaxSize    int    `yaml:"max_size" json:"max_size"`
 	MaxAge     int    `yaml:"max_age" json:"max_age"`
 	MaxBackups int    `yaml:"max_backups" json:"max_backups"`
+	Compress   bool   `yaml:"compress" json:"compress"`
+	LocalTime  bool   `yaml:"local_time" json:"local_time"`
+
+	// RotateEvery rotates the file every N hours counted from midnight, 24
+	// rotates daily at midnight. It combines with MaxSize.
+	RotateEvery int `yaml:"rotate_every" json:"rotate_every"`
+	// FilenamePattern names the file of each rotation period instead of Path,
+	// with %Y, %m, %d, %H and %M taken from the period start, e.g.
+	// /var/log/app-%Y%m%d.log. The files of past periods in its directory
+	// count as backups for MaxAge, MaxBackups and Compress.
+	FilenamePattern string `yaml:"filename_pattern" json:"filename_pattern"`
+
+	// Encoding is "json" (default) or "console" for human-friendly lines.
+	Encoding string `yaml:"encoding" json:"encoding"`
+
+	// ErrorPath additionally writes ERROR and above to a file of its own,
+	// rotated like Path.
+	ErrorPath string `yaml:"error_path" json:"error_path"`
+
+	// Outputs replaces Path with any number of outputs, ErrorPath still applies.
+	Outputs []OutputConfig `yaml:"outputs" json:"outputs"`
+
+	// StackLevel captures a stack for entries at this level and above, nil
+	// captures none. StackDepth limits the frames, 32 by default.
+	StackLevel *Level `yaml:"stack_level" json:"stack_level"`
+	StackDepth int    `yaml:"stack_depth" json:"stack_depth"`
+}
+
+// OutputConfig is one destination of InitDefault. An empty Path or "stdout"
+// and "stderr" write to the standard streams.
+type OutputConfig struct {
+	Path string `yaml:"path" json:"path"`
+	// Level is the minimum level of the output, nil keeps every entry the
+	// logger lets through.
+	Level *Level `yaml:"level" json:"level"`
+	// Encoding defaults to Config.Encoding.
+	Encoding        string `yaml:"encoding" json:"encoding"`
+	MaxSize         int    `yaml:"max_size" json:"max_size"`
+	MaxAge          int    `yaml:"max_age" json:"max_age"`
+	MaxBackups      int    `yaml:"max_backups" json:"max_backups"`
+	Compress        bool   `yaml:"compress" json:"compress"`
+	LocalTime       bool   `yaml:"local_time" json:"local_time"`
+	RotateEvery     int    `yaml:"rotate_every" json:"rotate_every"`
+	FilenamePattern string `yaml:"filename_pattern" json:"filename_pattern"`
+}
+
+// outputs returns the outputs InitDefault builds, a config without Outputs
+// has the single one described by Path.
+func (cfg Config) outputs() []OutputConfig {
+	outputs := append([]OutputConfig(nil), cfg.Outputs...)
+	if len(outputs) == 0 {
+		outputs = append(outputs, OutputConfig{
+			Path:            cfg.Path,
+			MaxSize:         cfg.MaxSize,
+			MaxAge:          cfg.MaxAge,
+			MaxBackups:      cfg.MaxBackups,
+			Compress:        cfg.Compress,
+			LocalTime:       cfg.LocalTime,
+			RotateEvery:     cfg.RotateEvery,
+			FilenamePattern: cfg.FilenamePattern,
+		})
+	}
+	if len(cfg.ErrorPath) != 0 {
+		level := ERROR
+		outputs = append(outputs, OutputConfig{
+			Path:        cfg.ErrorPath,
+			Level:       &level,
+			MaxSize:     cfg.MaxSize,
+			MaxAge:      cfg.MaxAge,
+			MaxBackups:  cfg.MaxBackups,
+			Compress:    cfg.Compress,
+			LocalTime:   cfg.LocalTime,
+			RotateEvery: cfg.RotateEvery,
+		})
+	}
+	for i := range outputs {
+		if outputs[i].Encoding == "" {
+			outputs[i].Encoding = cfg.Encoding
+		}
+		outputs[i].Encoding = strings.ToLower(outputs[i].Encoding)
+	}
+	return outputs
+}
+
+// options returns the logger options InitDefault uses besides its handlers.
+func (cfg Config) options() []Option {
+	options := []Option{WithLevel(cfg.Level), WithCaller(true), WithCallerSkip(1)}
+	if cfg.StackLevel != nil {
+		options = append(options, WithStacktrace(*cfg.StackLevel), WithStackDepth(cfg.StackDepth))
+	}
+	return options
 }
 
 func Init(options ...Option) error {
-	log = NewLogger(options...)
+	log = newLogger(options...)
 	return nil
 }
 
-func InitDefault(cfg Config) error {
-	ls := zapcore.AddSync(os.Stdout)
-	if len(cfg.Path) != 0 {
-		ls = zapcore.AddSync(&lumberjack.Logger{
-			Filename:   cfg.Path,
-			MaxSize:    cfg.MaxSize,
-			MaxAge:     cfg.MaxAge,
-			MaxBackups: cfg.MaxBackups,
-		})
-	}
+// outputCloser closes the files opened by InitDefault. It comes last among the
+// handlers, so the others are synced before their files are closed.
+type outputCloser []io.Closer
 
-	// default level INFO
-	level := zapcore.InfoLevel
-	zapLevel := map[string]zapcore.Level{
-		"DEBUG":   zapcore.DebugLevel,
-		"INFO":    zapcore.InfoLevel,
-		"WARNING": zapcore.WarnLevel,
-		"ERROR":   zapcore.ErrorLevel,
-		"PANIC":   zapcore.PanicLevel,
-		"FATAL":   zapcore.FatalLevel,
-	}
-	if lvl, ok := zapLevel[strings.ToUpper(cfg.Level)]; ok {
-		level = lvl
+func (outputCloser) Log(ctx context.Context, params Params) {}
+
+func (c outputCloser) Close() error {
+	var errs multiError
+	for _, closer := range c {
+		errs = errs.append(closer.Close())
 	}
+	return errs.err()
+}
 
-	conf := zap.NewProductionEncoderConfig()
-	conf.TimeKey = "t"
-	conf.LevelKey = "l"
-	conf.CallerKey = "c"
-	conf.EncodeLevel = capitalLevelEncoder
-	conf.EncodeTime = zapcore.ISO8601TimeEncoder
-	enc := zapcore.NewJSONEncoder(conf)
-	zapLogger := zap.New(zapcore.NewCore(enc, ls, level), zap.AddCaller(), zap.AddCallerSkip(CallerSkipOffset+1))
-	zap.ReplaceGlobals(zapLogger)
-
-	return Init(WithHandler(NewZapHandler(zapLogger)), WithCaller(true), WithCallerSkip(1))
-}
-
-func capitalLevelEncoder(lvl zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
-	switch lvl {
-	case zapcore.DebugLevel:
-		enc.AppendString("D")
-	case zapcore.InfoLevel:
-		enc.AppendString("I")
-	case zapcore.WarnLevel:
-		enc.AppendString("W")
-	case zapcore.ErrorLevel:
-		enc.AppendString("E")
-	case zapcore.DPanicLevel:
-		enc.AppendString("DP")
-	case zapcore.PanicLevel:
-		enc.AppendString("P")
-	case zapcore.FatalLevel:
-		enc.AppendString("F")
-	default:
-		enc.AppendString(fmt.Sprintf("LEVEL(%d)", lvl))
+// minLevelHandler drops the entries below min before they reach h.
+func minLevelHandler(h Handler, min *Level) Handler {
+	if min == nil {
+		return h
 	}
+	return NewRouteHandler(RouteAll).Route(MatchMinLevel(*min), h)
+}
+
+// With returns a child of the global logger. The child is called directly rather
+// than through the package-level wrappers, so one frame less is skipped.
+func With(fields ...interface{}) Logger {
+	return log.with(-1, fields...)
+}
+
+func Sync() error {
+	return log.Sync()
+}
+
+func Close() error {
+	return log.Close()
+}
+
+func SetLevel(level Level) {
+	log.SetLevel(level)
+}
+
+func GetLevel() Level {
+	return log.GetLevel()
 }
 
 func Fatal(ctx context.Context, args ...interface{}) {
@@ -156,3 +229,27 @@ func Debugv(ctx context.Context, param ...Param) {
 func Debugf(ctx context.Context, format string, args ...interface{}) {
 	log.Debugf(ctx, format, args...)
 }
+
+func Trace(ctx context.Context, args ...interface{}) {
+	log.Trace(ctx, args...)
+}
+
+func Tracev(ctx context.Context, param ...Param) {
+	log.Tracev(ctx, param...)
+}
+
+func Tracef(ctx context.Context, format string, args ...interface{}) {
+	log.Tracef(ctx, format, args...)
+}
+
+func Log(ctx context.Context, level Level, args ...interface{}) {
+	log.Log(ctx, level, args...)
+}
+
+func Logv(ctx context.Context, level Level, param ...Param) {
+	log.Logv(ctx, level, param...)
+}
+
+func Logf(ctx context.Context, level Level, format string, args ...interface{}) {
+	log.Logf(ctx, level, format, args...)
+}
@@ -0,0 +1,202 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ Handler      = (*LogfmtHandler)(nil)
+	_ BatchHandler = (*LogfmtHandler)(nil)
+	_ Syncer       = (*LogfmtHandler)(nil)
+)
+
+// LogfmtHandler writes entries as logfmt lines:
+//
+//	t=2006-01-02T15:04:05.000Z0700 l=INFO c=server/main.go:42 msg="listening on :8080" db.host=localhost
+//
+// Values with spaces, equals signs, quotes or control characters are quoted,
+// nested maps are flattened into dotted keys.
+type LogfmtHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogfmtHandler(w io.Writer) *LogfmtHandler {
+	return &LogfmtHandler{w: w}
+}
+
+func (h *LogfmtHandler) Log(ctx context.Context, params Params) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	h.appendLogfmt(buf, params)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+// LogBatch writes entries with a single Write.
+func (h *LogfmtHandler) LogBatch(entries []BatchEntry) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	for _, e := range entries {
+		h.appendLogfmt(buf, e.Params)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.w.Write(buf.Bytes())
+}
+
+func (h *LogfmtHandler) appendLogfmt(buf *bytes.Buffer, params Params) {
+	t := params.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	buf.WriteString("t=")
+	buf.WriteString(t.Format("2006-01-02T15:04:05.000Z0700"))
+	buf.WriteString(" l=")
+	buf.WriteString(quoteValue(params.Level.String()))
+	if params.Caller != nil {
+		buf.WriteString(" c=")
+		buf.WriteString(quoteValue(shortCaller(params.Caller)))
+	}
+	buf.WriteString(" msg=")
+	buf.WriteString(quoteValue(params.Message()))
+	if len(params.Stack) > 0 {
+		frames := make([]string, len(params.Stack))
+		for i, f := range params.Stack {
+			frames[i] = f.Function + " " + shortCaller(&params.Stack[i])
+		}
+		appendLogfmtPair(buf, "stack", strings.Join(frames, "; "))
+	}
+
+	prefix := ""
+	rangeFields(params.Fields, func(f Field) {
+		if f.Kind == NamespaceKind {
+			prefix += logfmtKey(f.Key) + "."
+			return
+		}
+		if f.Kind == ErrorKind {
+			appendLogfmtError(buf, prefix+logfmtKey(f.Key), f.Interface.(error))
+			return
+		}
+		if f.Kind == ObjectKind || f.Kind == AnyKind {
+			appendLogfmtValue(buf, prefix+logfmtKey(f.Key), reflect.ValueOf(f.Interface))
+			return
+		}
+		appendLogfmtPair(buf, prefix+logfmtKey(f.Key), formatValue(f))
+	})
+	buf.WriteByte('\n')
+}
+
+func (h *LogfmtHandler) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return syncWriter(h.w)
+}
+
+func appendLogfmtPair(buf *bytes.Buffer, key, value string) {
+	buf.WriteByte(' ')
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	buf.WriteString(quoteValue(value))
+}
+
+// appendLogfmtError writes the message of err under key and its type, causes,
+// fields and stack under dotted keys.
+func appendLogfmtError(buf *bytes.Buffer, key string, err error) {
+	info := newErrorInfo(err)
+	appendLogfmtPair(buf, key, info.Msg)
+	appendLogfmtPair(buf, key+".type", info.Type)
+	if len(info.Chain) > 0 {
+		causes := make([]string, len(info.Chain))
+		for i, c := range info.Chain {
+			causes[i] = c.Type + ": " + c.Msg
+		}
+		appendLogfmtPair(buf, key+".chain", strings.Join(causes, "; "))
+	}
+	if len(info.Fields) > 0 {
+		appendLogfmtValue(buf, key+".fields", reflect.ValueOf(info.Fields))
+	}
+	if len(info.Stack) > 0 {
+		frames := make([]string, len(info.Stack))
+		for i, f := range info.Stack {
+			frames[i] = f.Func + " " + shortCaller(&Caller{File: f.File, Line: f.Line})
+		}
+		appendLogfmtPair(buf, key+".stack", strings.Join(frames, "; "))
+	}
+}
+
+// appendLogfmtValue writes v under key, maps are expanded into one pair per
+// entry with the keys sorted.
+func appendLogfmtValue(buf *bytes.Buffer, key string, v reflect.Value) {
+	m := v
+	for m.Kind() == reflect.Ptr || m.Kind() == reflect.Interface {
+		m = m.Elem()
+	}
+	if m.Kind() != reflect.Map || m.IsNil() {
+		switch {
+		case !v.IsValid():
+			appendLogfmtPair(buf, key, "<nil>")
+		case !v.CanInterface():
+			appendLogfmtPair(buf, key, fmt.Sprint(v))
+		default:
+			appendLogfmtPair(buf, key, formatValue(Any(key, v.Interface())))
+		}
+		return
+	}
+	v = m
+	if v.Len() == 0 {
+		appendLogfmtPair(buf, key, "")
+		return
+	}
+	keys := v.MapKeys()
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = fmt.Sprint(k.Interface())
+	}
+	sort.Sort(mapKeys{keys: keys, names: names})
+	for i, k := range keys {
+		appendLogfmtValue(buf, key+"."+logfmtKey(names[i]), v.MapIndex(k))
+	}
+}
+
+type mapKeys struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (m mapKeys) Len() int           { return len(m.keys) }
+func (m mapKeys) Less(i, j int) bool { return m.names[i] < m.names[j] }
+func (m mapKeys) Swap(i, j int) {
+	m.keys[i], m.keys[j] = m.keys[j], m.keys[i]
+	m.names[i], m.names[j] = m.names[j], m.names[i]
+}
+
+// logfmtKey replaces the characters a logfmt key can't contain.
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, key)
+}
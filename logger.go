@@ -1,9 +1,15 @@
 package xlog
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -11,28 +17,117 @@ const (
 )
 
 var (
+	_ Logger = (*logger)(nil)
+
 	// global middleware
 	_middleware Middleware
 )
 
 type (
+	Logger interface {
+		Fatal(ctx context.Context, args ...interface{})
+		Fatalv(ctx context.Context, param ...Param)
+		Fatalf(ctx context.Context, format string, args ...interface{})
+		Panic(ctx context.Context, args ...interface{})
+		Panicv(ctx context.Context, param ...Param)
+		Panicf(ctx context.Context, format string, args ...interface{})
+		Error(ctx context.Context, args ...interface{})
+		Errorv(ctx context.Context, param ...Param)
+		Errorf(ctx context.Context, format string, args ...interface{})
+		Warning(ctx context.Context, args ...interface{})
+		Warningv(ctx context.Context, param ...Param)
+		Warningf(ctx context.Context, format string, args ...interface{})
+		Info(ctx context.Context, args ...interface{})
+		Infov(ctx context.Context, param ...Param)
+		Infof(ctx context.Context, format string, args ...interface{})
+		Debug(ctx context.Context, args ...interface{})
+		Debugv(ctx context.Context, param ...Param)
+		Debugf(ctx context.Context, format string, args ...interface{})
+		Trace(ctx context.Context, args ...interface{})
+		Tracev(ctx context.Context, param ...Param)
+		Tracef(ctx context.Context, format string, args ...interface{})
+
+		// Log, Logv and Logf log at an arbitrary level, e.g. a custom one
+		// registered with RegisterLevel.
+		Log(ctx context.Context, level Level, args ...interface{})
+		Logv(ctx context.Context, level Level, param ...Param)
+		Logf(ctx context.Context, level Level, format string, args ...interface{})
+
+		// With returns a child logger whose fields are prepended to every entry.
+		With(fields ...interface{}) Logger
+
+		// SetLevel changes the minimum level at runtime, it is shared with all
+		// child loggers created by With, see ForkLevel.
+		SetLevel(level Level)
+		GetLevel() Level
+
+		// Sync flushes every handler implementing Syncer. Close closes every
+		// handler implementing Closer and syncs the others, it is meant to be
+		// called once on the root logger at shutdown.
+		Sync() error
+		Close() error
+	}
+
 	logger struct {
 		addCaller  bool
 		callerSkip int
+		addStack   bool
+		stackLevel Level
+		stackDepth int
+		exit       func(code int)
+		level      *levelVar
+		fields     []interface{}
 		handlers   []Handler
 		middleware Middleware
 	}
 
+	// Handler receives every enabled entry. Params and its slices are reused
+	// once Log returns, handlers that keep them must use Params.Clone.
 	Handler interface {
 		Log(ctx context.Context, params Params)
 	}
 
+	// BatchHandler is implemented by handlers that write several entries at
+	// once, AsyncHandler passes them its batches. Like Params in Log, the
+	// entries are reused once LogBatch returns.
+	BatchHandler interface {
+		Handler
+		LogBatch(entries []BatchEntry)
+	}
+
+	// BatchEntry is an entry of a batch, with the context it was logged with.
+	BatchEntry struct {
+		Ctx    context.Context
+		Params Params
+	}
+
+	// Syncer is implemented by handlers that buffer output.
+	Syncer interface {
+		Sync() error
+	}
+
+	// Closer is implemented by handlers that hold resources such as files.
+	Closer interface {
+		Close() error
+	}
+
 	Params struct {
+		Time   time.Time
 		Caller *Caller
 		Level  Level
 		Format *string
 		Args   []interface{}
 		Fields []interface{}
+
+		// Stack holds the frames from the caller outwards when a stack was
+		// captured, see WithStacktrace and Stack.
+		Stack []Caller
+
+		// ContextFields is the leading part of Fields that came from the context
+		// via WithFields, the logger's own and call-site fields follow it.
+		ContextFields []interface{}
+
+		dropped bool
 	}
 
 	Param func(*Params)
@@ -41,105 +136,260 @@ type (
 )
 
 func (l *logger) Fatal(ctx context.Context, args ...interface{}) {
-	l.log(ctx, FATAL, nil, Args(args...))
+	l.log(ctx, FATAL, "", false, args, nil)
 }
 
 func (l *logger) Fatalv(ctx context.Context, param ...Param) {
-	l.log(ctx, FATAL, nil, param...)
+	l.log(ctx, FATAL, "", false, nil, param)
 }
 
 func (l *logger) Fatalf(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, FATAL, &format, Args(args...))
+	l.log(ctx, FATAL, format, true, args, nil)
 }
 
 func (l *logger) Panic(ctx context.Context, args ...interface{}) {
-	l.log(ctx, PANIC, nil, Args(args...))
+	l.log(ctx, PANIC, "", false, args, nil)
 }
 
 func (l *logger) Panicv(ctx context.Context, param ...Param) {
-	l.log(ctx, PANIC, nil, param...)
+	l.log(ctx, PANIC, "", false, nil, param)
 }
 
 func (l *logger) Panicf(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, PANIC, &format, Args(args...))
+	l.log(ctx, PANIC, format, true, args, nil)
 }
 
 func (l *logger) Error(ctx context.Context, args ...interface{}) {
-	l.log(ctx, ERROR, nil, Args(args...))
+	l.log(ctx, ERROR, "", false, args, nil)
 }
 
 func (l *logger) Errorv(ctx context.Context, param ...Param) {
-	l.log(ctx, ERROR, nil, param...)
+	l.log(ctx, ERROR, "", false, nil, param)
 }
 
 func (l *logger) Errorf(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, ERROR, &format, Args(args...))
+	l.log(ctx, ERROR, format, true, args, nil)
 }
 
 func (l *logger) Warning(ctx context.Context, args ...interface{}) {
-	l.log(ctx, WARNING, nil, Args(args...))
+	l.log(ctx, WARNING, "", false, args, nil)
 }
 
 func (l *logger) Warningv(ctx context.Context, param ...Param) {
-	l.log(ctx, WARNING, nil, param...)
+	l.log(ctx, WARNING, "", false, nil, param)
 }
 
 func (l *logger) Warningf(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, WARNING, &format, Args(args...))
+	l.log(ctx, WARNING, format, true, args, nil)
 }
 
 func (l *logger) Info(ctx context.Context, args ...interface{}) {
-	l.log(ctx, INFO, nil, Args(args...))
+	l.log(ctx, INFO, "", false, args, nil)
 }
 
 func (l *logger) Infov(ctx context.Context, param ...Param) {
-	l.log(ctx, INFO, nil, param...)
+	l.log(ctx, INFO, "", false, nil, param)
 }
 
 func (l *logger) Infof(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, INFO, &format, Args(args...))
+	l.log(ctx, INFO, format, true, args, nil)
 }
 
 func (l *logger) Debug(ctx context.Context, args ...interface{}) {
-	l.log(ctx, DEBUG, nil, Args(args...))
+	l.log(ctx, DEBUG, "", false, args, nil)
 }
 
 func (l *logger) Debugv(ctx context.Context, param ...Param) {
-	l.log(ctx, DEBUG, nil, param...)
+	l.log(ctx, DEBUG, "", false, nil, param)
 }
 
 func (l *logger) Debugf(ctx context.Context, format string, args ...interface{}) {
-	l.log(ctx, DEBUG, &format, Args(args...))
+	l.log(ctx, DEBUG, format, true, args, nil)
+}
+
+func (l *logger) Trace(ctx context.Context, args ...interface{}) {
+	l.log(ctx, TRACE, "", false, args, nil)
 }
 
-func (l *logger) log(ctx context.Context, level Level, format *string, param ...Param) {
-	params := Params{
-		Level:  level,
-		Format: format,
-		Args:   make([]interface{}, 0),
-		Fields: make([]interface{}, 0),
+func (l *logger) Tracev(ctx context.Context, param ...Param) {
+	l.log(ctx, TRACE, "", false, nil, param)
+}
+
+func (l *logger) Tracef(ctx context.Context, format string, args ...interface{}) {
+	l.log(ctx, TRACE, format, true, args, nil)
+}
+
+func (l *logger) Log(ctx context.Context, level Level, args ...interface{}) {
+	l.log(ctx, level, "", false, args, nil)
+}
+
+func (l *logger) Logv(ctx context.Context, level Level, param ...Param) {
+	l.log(ctx, level, "", false, nil, param)
+}
+
+func (l *logger) Logf(ctx context.Context, level Level, format string, args ...interface{}) {
+	l.log(ctx, level, format, true, args, nil)
+}
+
+func (l *logger) With(fields ...interface{}) Logger {
+	return l.with(0, fields...)
+}
+
+func (l *logger) with(callerSkip int, fields ...interface{}) *logger {
+	child := *l
+	child.callerSkip += callerSkip
+	child.fields = make([]interface{}, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return &child
+}
+
+// ForkLevel returns a copy of l with a level of its own, starting at the level
+// of l, so SetLevel on one doesn't change the other. Children created by With
+// from the copy share its level. Loggers not created by xlog are returned as
+// they are.
+func ForkLevel(l Logger) Logger {
+	c, ok := l.(*logger)
+	if !ok {
+		return l
 	}
+	child := c.with(0)
+	child.level = newLevelVar(c.level.Load())
+	return child
+}
+
+func (l *logger) SetLevel(level Level) {
+	l.level.Store(level)
+}
+
+func (l *logger) GetLevel() Level {
+	return l.level.Load()
+}
+
+func (l *logger) Sync() error {
+	var errs multiError
+	for _, h := range l.handlers {
+		if s, ok := h.(Syncer); ok {
+			errs = errs.append(s.Sync())
+		}
+	}
+	return errs.err()
+}
+
+func (l *logger) Close() error {
+	var errs multiError
+	for _, h := range l.handlers {
+		switch c := h.(type) {
+		case Closer:
+			errs = errs.append(c.Close())
+		case Syncer:
+			errs = errs.append(c.Sync())
+		}
+	}
+	return errs.err()
+}
+
+// entry is the pooled state behind a single log call, Params.Caller and
+// Params.Format point into it so they don't need their own allocations.
+type entry struct {
+	params Params
+	caller Caller
+	format string
+}
+
+var entryPool = sync.Pool{
+	New: func() interface{} {
+		return &entry{params: Params{
+			Args:   make([]interface{}, 0, 8),
+			Fields: make([]interface{}, 0, 16),
+		}}
+	},
+}
+
+func (l *logger) log(ctx context.Context, level Level, format string, formatted bool, args []interface{}, param []Param) {
+	// a disabled PANIC or FATAL isn't delivered but still panics or exits, as
+	// the calls do whatever the level
+	enabled := l.level.Load().Enabled(level)
+	if !enabled && level != PANIC && level != FATAL {
+		return
+	}
+	e := entryPool.Get().(*entry)
+	defer e.free()
+
+	params := &e.params
+	params.Time = time.Now()
+	params.Level = level
+	if formatted {
+		e.format = format
+		params.Format = &e.format
+	}
+	params.Args = append(params.Args, args...)
+	ctxFields := FieldsFromContext(ctx)
+	params.Fields = append(params.Fields, ctxFields...)
+	params.ContextFields = params.Fields[:len(ctxFields):len(ctxFields)]
+	params.Fields = append(params.Fields, l.fields...)
 	for _, p := range param {
-		p(&params)
+		p(params)
 	}
-	if l.addCaller {
-		params.Caller = GetCaller(l.callerSkip + CallerSkipOffset)
+	// a Param may already have supplied the caller, e.g. from an slog.Record
+	if l.addCaller && params.Caller == nil {
+		getCaller(&e.caller, l.callerSkip+CallerSkipOffset)
+		params.Caller = &e.caller
 	}
-	if l.middleware != nil || _middleware != nil {
-		closure := func(ctx context.Context, params *Params) {}
+	if l.addStack && params.Stack == nil && l.stackLevel.Enabled(level) {
+		params.Stack = captureStack(l.callerSkip+CallerSkipOffset, l.stackDepth)
+	}
+	if enabled && (l.middleware != nil || _middleware != nil) {
+		// the handlers get what reaches the end of the chain if it does, a
+		// middleware may pass on another context or Params
+		nextCtx, next := ctx, params
+		closure := func(ctx context.Context, params *Params) {
+			nextCtx, next = ctx, params
+		}
 		if l.middleware != nil {
 			closure = l.middleware(closure)
 		}
 		if _middleware != nil {
 			closure = _middleware(closure)
 		}
-		closure(ctx, &params)
+		closure(ctx, params)
+		ctx, params = nextCtx, next
 	}
-	for _, h := range l.handlers {
-		h.Log(ctx, params)
+	if enabled && !params.dropped {
+		for _, h := range l.handlers {
+			h.Log(ctx, *params)
+		}
+	}
+	// handlers never panic or exit themselves, every one of them gets the entry
+	// and is flushed first
+	switch level {
+	case PANIC:
+		err := &PanicError{Message: params.Message(), Fields: params.Clone().Fields}
+		l.Sync()
+		panic(err)
+	case FATAL:
+		l.Sync()
+		l.exit(1)
 	}
 }
 
+// free returns e to the pool. Oversized slices are dropped instead of being
+// kept alive by the pool.
+func (e *entry) free() {
+	if cap(e.params.Args) > 64 || cap(e.params.Fields) > 128 {
+		return
+	}
+	args, fields := e.params.Args[:0], e.params.Fields[:0]
+	for i := range e.params.Args {
+		e.params.Args[i] = nil
+	}
+	for i := range e.params.Fields {
+		e.params.Fields[i] = nil
+	}
+	*e = entry{params: Params{Args: args, Fields: fields}}
+	entryPool.Put(e)
+}
+
 func WithHandler(handlers ...Handler) Option {
 	return func(l *logger) {
 		l.handlers = append(l.handlers, handlers...)
@@ -152,12 +402,41 @@ func WithMiddleware(middleware ...Middleware) Option {
 	}
 }
 
+func WithLevel(level Level) Option {
+	return func(l *logger) {
+		l.level.Store(level)
+	}
+}
+
 func WithCaller(enabled bool) Option {
 	return func(l *logger) {
 		l.addCaller = enabled
 	}
 }
 
+// WithExitFunc replaces os.Exit as the function called after a FATAL entry,
+// mainly for tests.
+func WithExitFunc(exit func(code int)) Option {
+	return func(l *logger) {
+		l.exit = exit
+	}
+}
+
+// WithStacktrace captures a stack for entries at level and above.
+func WithStacktrace(level Level) Option {
+	return func(l *logger) {
+		l.addStack = true
+		l.stackLevel = level
+	}
+}
+
+// WithStackDepth sets how many frames WithStacktrace captures, 32 by default.
+func WithStackDepth(depth int) Option {
+	return func(l *logger) {
+		l.stackDepth = depth
+	}
+}
+
 func WithCallerSkip(skip int) Option {
 	return func(l *logger) {
 		l.callerSkip += skip
@@ -187,8 +466,70 @@ func Fields(fields ...interface{}) Param {
 	}
 }
 
-func NewLogger(options ...Option) *logger {
-	l := &logger{handlers: make([]Handler, 0)}
+func Fieldsv(fields ...Field) Param {
+	return func(p *Params) {
+		for _, f := range fields {
+			p.Fields = append(p.Fields, f)
+		}
+	}
+}
+
+// Drop keeps the entry from the handlers, it is meant for middleware. PANIC
+// and FATAL entries still panic and exit.
+func (p *Params) Drop() {
+	p.dropped = true
+}
+
+// Clone returns a copy of p that doesn't share memory with the logger's pool.
+func (p Params) Clone() Params {
+	c := p
+	c.Args = append([]interface{}(nil), p.Args...)
+	c.Fields = append([]interface{}(nil), p.Fields...)
+	n := len(p.ContextFields)
+	if n > len(c.Fields) {
+		n = len(c.Fields)
+	}
+	c.ContextFields = c.Fields[:n:n]
+	if p.Format != nil {
+		format := *p.Format
+		c.Format = &format
+	}
+	if p.Caller != nil {
+		caller := *p.Caller
+		c.Caller = &caller
+	}
+	return c
+}
+
+// Message formats Args with Format, or with fmt.Sprint if there's no format.
+func (p Params) Message() string {
+	if len(p.Args) == 0 {
+		if p.Format == nil {
+			return ""
+		}
+		return *p.Format
+	}
+	if p.Format != nil && *p.Format != "" {
+		return fmt.Sprintf(*p.Format, p.Args...)
+	}
+	if len(p.Args) == 1 {
+		if s, ok := p.Args[0].(string); ok {
+			return s
+		}
+	}
+	return fmt.Sprint(p.Args...)
+}
+
+func NewLogger(options ...Option) Logger {
+	return newLogger(options...)
+}
+
+func newLogger(options ...Option) *logger {
+	l := &logger{
+		exit:     os.Exit,
+		level:    newLevelVar(DEBUG),
+		handlers: make([]Handler, 0),
+	}
 	for _, o := range options {
 		o(l)
 	}
@@ -200,6 +541,10 @@ func NewLogger(options ...Option) *logger {
 type (
 	Closure func(ctx context.Context, params *Params)
 
+	// Middleware wraps the processing of an entry before the handlers. The
+	// handlers get the entry whether or not the chain calls next, with the
+	// context and Params passed to the last next if it does. A middleware
+	// drops an entry with Params.Drop.
 	Middleware func(Closure) Closure
 )
 
@@ -219,6 +564,57 @@ func Use(middleware ...Middleware) {
 	_middleware = withMiddlewareChain(_middleware, middleware...)
 }
 
+// bufferPool holds the buffers handlers encode lines into.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+//------------------------------------------------------------------------------
+
+// PanicError is the value a logger panics with after a PANIC entry has been
+// handled.
+type PanicError struct {
+	Message string
+	Fields  []interface{}
+}
+
+func (e *PanicError) Error() string {
+	return e.Message
+}
+
+//------------------------------------------------------------------------------
+
+// multiError collects the errors of fanning out to several handlers.
+type multiError []error
+
+func (m multiError) append(err error) multiError {
+	if err == nil {
+		return m
+	}
+	return append(m, err)
+}
+
+func (m multiError) err() error {
+	switch len(m) {
+	case 0:
+		return nil
+	case 1:
+		return m[0]
+	default:
+		return m
+	}
+}
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
 //------------------------------------------------------------------------------
 
 type Caller struct {
@@ -230,16 +626,30 @@ type Caller struct {
 }
 
 func GetCaller(skip int) *Caller {
-	function := "???"
-	pc, file, line, ok := runtime.Caller(skip)
-	if ok {
-		function = runtime.FuncForPC(pc).Name()
-	}
-	return &Caller{
-		PC:       pc,
-		File:     file,
-		Filename: filepath.Base(file),
+	c := &Caller{}
+	getCaller(c, skip+1)
+	return c
+}
+
+// getCaller uses runtime.Callers rather than runtime.Caller, its PC stays
+// unique when the logging methods are inlined into the caller and is what
+// runtime.CallersFrames and log/slog expect.
+func getCaller(c *Caller, skip int) {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+1, pcs[:]) == 0 {
+		*c = Caller{Function: "???"}
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	function := frame.Function
+	if function == "" {
+		function = "???"
+	}
+	*c = Caller{
+		PC:       pcs[0],
+		File:     frame.File,
+		Filename: filepath.Base(frame.File),
 		Function: function,
-		Line:     line,
+		Line:     frame.Line,
 	}
 }
@@ -0,0 +1,298 @@
+package xlog
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordHandler keeps the entries it gets.
+type recordHandler struct {
+	mu      sync.Mutex
+	entries []Params
+}
+
+func (h *recordHandler) Log(ctx context.Context, params Params) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, params.Clone())
+}
+
+func (h *recordHandler) Entries() []Params {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Params(nil), h.entries...)
+}
+
+// waitEntries waits up to a second for h to have n entries and returns them.
+func waitEntries(t *testing.T, h *recordHandler, n int) []Params {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		entries := h.Entries()
+		if len(entries) >= n {
+			return entries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d entries, want %d", len(entries), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fieldValue returns the value of the field key of params, or nil.
+func fieldValue(params Params, key string) interface{} {
+	var v interface{}
+	rangeFields(params.Fields, func(f Field) {
+		if f.Key == key {
+			v = f.Value()
+		}
+	})
+	return v
+}
+
+// useLogger replaces the global logger until the test ends.
+func useLogger(tb testing.TB, options ...Option) {
+	old := log
+	log = newLogger(options...)
+	tb.Cleanup(func() { log = old })
+}
+
+func TestMiddlewareParams(t *testing.T) {
+	h := &recordHandler{}
+	mw := func(next Closure) Closure {
+		return func(ctx context.Context, params *Params) {
+			switch params.Message() {
+			case "drop":
+				params.Drop()
+			case "in place":
+				// handlers get the entry without next being called
+				params.Args[0] = "changed in place"
+			default:
+				p := params.Clone()
+				p.Args = []interface{}{"replaced"}
+				next(ctx, &p)
+			}
+		}
+	}
+	l := newLogger(WithHandler(h), WithMiddleware(mw))
+	for _, msg := range []string{"original", "drop", "in place"} {
+		l.Info(context.Background(), msg)
+	}
+
+	var got []string
+	for _, e := range h.Entries() {
+		got = append(got, e.Message())
+	}
+	if want := []string{"replaced", "changed in place"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+// fieldKeys returns the keys of fields in order.
+func fieldKeys(fields []interface{}) []string {
+	var keys []string
+	rangeFields(fields, func(f Field) {
+		keys = append(keys, f.Key)
+	})
+	return keys
+}
+
+func TestContextFields(t *testing.T) {
+	h := &recordHandler{}
+	l := NewLogger(WithHandler(h)).With("logger", 1)
+	ctx := WithFields(context.Background(), "request_id", "r1")
+	ctx = WithFields(ctx, "user", "bob")
+	l.Infov(ctx, Args("handled"), Fields("status", 200))
+
+	entries := h.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	if got, want := fieldKeys(e.Fields), []string{"request_id", "user", "logger", "status"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %q, want context, logger and call-site fields in order %q", got, want)
+	}
+	if got, want := fieldKeys(e.ContextFields), []string{"request_id", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("context fields = %q, want %q", got, want)
+	}
+}
+
+func TestWith(t *testing.T) {
+	h := &recordHandler{}
+	parent := NewLogger(WithHandler(h)).With("service", "api")
+	child := parent.With("component", "db")
+	child.Info(context.Background(), "child")
+	parent.Info(context.Background(), "parent")
+
+	entries := h.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if got, want := fieldKeys(entries[0].Fields), []string{"service", "component"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("child fields = %q, want %q", got, want)
+	}
+	if got, want := fieldKeys(entries[1].Fields), []string{"service"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parent fields = %q, want %q unchanged by the child", got, want)
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	h := &recordHandler{}
+	parent := NewLogger(WithHandler(h), WithLevel(INFO))
+	child := parent.With("component", "db")
+	ctx := context.Background()
+
+	child.Debug(ctx, "hidden")
+	parent.SetLevel(DEBUG)
+	if got := child.GetLevel(); got != DEBUG {
+		t.Errorf("child level = %v, want the DEBUG set on its parent", got)
+	}
+	child.Debug(ctx, "shown")
+	child.SetLevel(WARNING)
+	if got := parent.GetLevel(); got != WARNING {
+		t.Errorf("parent level = %v, want the WARNING set on its child", got)
+	}
+	parent.Info(ctx, "hidden")
+
+	var got []string
+	for _, e := range h.Entries() {
+		got = append(got, e.Message())
+	}
+	if want := []string{"shown"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+// syncHandler records entries and counts its syncs.
+type syncHandler struct {
+	recordHandler
+	synced int
+}
+
+func (h *syncHandler) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.synced++
+	return nil
+}
+
+func (h *syncHandler) state() (entries, synced int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.entries), h.synced
+}
+
+func TestPanicAndFatal(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		level       Level
+		loggerLevel Level
+		wantEntries int
+	}{
+		{"panic enabled", PANIC, DEBUG, 1},
+		{"panic disabled", PANIC, Level(100), 0},
+		{"fatal enabled", FATAL, DEBUG, 1},
+		{"fatal disabled", FATAL, Level(100), 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := []*syncHandler{{}, {}}
+			// the state of the handlers when the logger exits or panics
+			type state struct{ entries, synced int }
+			var states []state
+			snapshot := func() {
+				for _, h := range handlers {
+					entries, synced := h.state()
+					states = append(states, state{entries, synced})
+				}
+			}
+			exitCode := -1
+			l := newLogger(WithHandler(handlers[0], handlers[1]), WithLevel(tt.loggerLevel), WithExitFunc(func(code int) {
+				snapshot()
+				exitCode = code
+			}))
+
+			var recovered interface{}
+			func() {
+				defer func() { recovered = recover() }()
+				l.Logv(context.Background(), tt.level, Args("boom"), Fieldsv(String("k", "v")))
+			}()
+
+			if tt.level == PANIC {
+				snapshot()
+				err, ok := recovered.(*PanicError)
+				if !ok {
+					t.Fatalf("recovered %#v, want a *PanicError", recovered)
+				}
+				if err.Message != "boom" || len(err.Fields) != 1 || err.Fields[0].(Field).Key != "k" {
+					t.Errorf("PanicError = %q %v, want boom with k", err.Message, err.Fields)
+				}
+				if exitCode != -1 {
+					t.Errorf("PANIC exited with %d", exitCode)
+				}
+			} else {
+				if recovered != nil {
+					t.Fatalf("FATAL panicked with %v", recovered)
+				}
+				if exitCode != 1 {
+					t.Errorf("exit code = %d, want 1", exitCode)
+				}
+			}
+			want := state{tt.wantEntries, 1}
+			if len(states) != len(handlers) || states[0] != want || states[1] != want {
+				t.Errorf("handlers = %+v when leaving, want %+v each", states, want)
+			}
+		})
+	}
+}
+
+// The package-level functions call the concrete logger, arguments of calls
+// through the Logger interface escape and are allocated by the caller.
+func TestDisabledAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't stable under the race detector")
+	}
+	useLogger(t, WithHandler(NewJSONHandler(ioutil.Discard)), WithLevel(INFO), WithCaller(true))
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		Debug(ctx, "request handled")
+		Debugf(ctx, "request %s handled in %d", "/users", 200)
+		Debugv(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	})
+	if allocs != 0 {
+		t.Errorf("disabled calls allocate %v times, want 0", allocs)
+	}
+}
+
+func BenchmarkDisabled(b *testing.B) {
+	useLogger(b, WithHandler(NewJSONHandler(ioutil.Discard)), WithLevel(INFO), WithCaller(true))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Debugv(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	}
+}
+
+func BenchmarkDisabledf(b *testing.B) {
+	useLogger(b, WithHandler(NewJSONHandler(ioutil.Discard)), WithLevel(INFO), WithCaller(true))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Debugf(ctx, "request %s handled in %d", "/users", 200)
+	}
+}
+
+func BenchmarkEnabledJSON(b *testing.B) {
+	useLogger(b, WithHandler(NewJSONHandler(ioutil.Discard)))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infov(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	}
+}
@@ -0,0 +1,63 @@
+//go:build xlog_nozap
+// +build xlog_nozap
+
+package xlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// InitDefault without zap writes with JSONHandler or ConsoleHandler. Files are
+// appended to as they are, the rotation settings need the zap build: MaxSize,
+// MaxAge and MaxBackups are ignored, RotateEvery, FilenamePattern, Compress and
+// LocalTime are an error.
+func InitDefault(cfg Config) error {
+	var (
+		handlers []Handler
+		closers  outputCloser
+	)
+	for _, o := range cfg.outputs() {
+		w, c, err := openOutput(o)
+		if err != nil {
+			closers.Close()
+			return err
+		}
+		if c != nil {
+			closers = append(closers, c)
+		}
+		var h Handler
+		switch o.Encoding {
+		case "", "json":
+			h = NewJSONHandler(w)
+		case "console":
+			h = NewConsoleHandler(w)
+		default:
+			closers.Close()
+			return fmt.Errorf("xlog: unknown encoding %q", o.Encoding)
+		}
+		handlers = append(handlers, minLevelHandler(h, o.Level))
+	}
+	if len(closers) > 0 {
+		handlers = append(handlers, closers)
+	}
+	return Init(append([]Option{WithHandler(handlers...)}, cfg.options()...)...)
+}
+
+func openOutput(o OutputConfig) (io.Writer, io.Closer, error) {
+	if o.RotateEvery != 0 || o.FilenamePattern != "" || o.Compress || o.LocalTime {
+		return nil, nil, fmt.Errorf("xlog: rotate_every, filename_pattern, compress and local_time of %q need the zap build", o.Path)
+	}
+	switch o.Path {
+	case "", "stdout":
+		return os.Stdout, nil, nil
+	case "stderr":
+		return os.Stderr, nil, nil
+	}
+	f, err := os.OpenFile(o.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
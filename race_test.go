@@ -0,0 +1,8 @@
+//go:build race
+// +build race
+
+package xlog
+
+// raceEnabled skips allocation checks, sync.Pool drops items at random under
+// the race detector.
+const raceEnabled = true
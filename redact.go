@@ -0,0 +1,461 @@
+package xlog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactStrategy decides what replaces a sensitive value.
+type RedactStrategy int
+
+const (
+	// RedactMask replaces the value with [REDACTED].
+	RedactMask RedactStrategy = iota
+	// RedactPartial masks all but the last quarter of the value, at most
+	// four characters, e.g. ************1111 for a card number.
+	RedactPartial
+	// RedactHash replaces the value with hmac: and the start of its
+	// HMAC-SHA256, so equal values can still be matched across entries.
+	RedactHash
+)
+
+// maxRedactDepth bounds the nesting redaction walks into, deeper values and
+// cyclic ones are kept as they are.
+const maxRedactDepth = 10
+
+var (
+	// DefaultRedactKeys are the keys redacted when WithRedactKeys isn't used.
+	DefaultRedactKeys = []string{
+		"password", "passwd", "secret", "token", "authorization",
+		"apikey", "cookie", "privatekey", "credential",
+	}
+
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// CardNumberPattern matches 13 to 19 digits, optionally grouped by spaces
+	// or dashes. Matches are only redacted if they pass the Luhn check and
+	// start like a card of a major network, as one in ten numbers of that
+	// length passes Luhn. Millisecond and nanosecond Unix times never match,
+	// but IDs starting like cards still do one time in ten.
+	CardNumberPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	JWTPattern        = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+type (
+	RedactOption func(*redactor)
+
+	redactor struct {
+		keys     []string
+		patterns []*regexp.Regexp
+		strategy RedactStrategy
+		hashKey  []byte
+	}
+)
+
+// WithRedactKeys sets the sensitive keys of fields, maps and struct fields.
+// Keys are compared without case, dashes, underscores and dots, and match if
+// they contain one of keys, so token also redacts access_token.
+func WithRedactKeys(keys ...string) RedactOption {
+	return func(r *redactor) {
+		r.keys = make([]string, len(keys))
+		for i, k := range keys {
+			r.keys[i] = normalizeRedactKey(k)
+		}
+	}
+}
+
+// WithRedactPatterns sets the patterns redacted in strings and messages,
+// EmailPattern, CardNumberPattern and JWTPattern by default.
+func WithRedactPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(r *redactor) {
+		r.patterns = patterns
+	}
+}
+
+func WithRedactStrategy(strategy RedactStrategy) RedactOption {
+	return func(r *redactor) {
+		r.strategy = strategy
+	}
+}
+
+// WithRedactHashKey sets the HMAC key of RedactHash. Without it a random key
+// is generated, so hashes only match within the process.
+func WithRedactHashKey(key []byte) RedactOption {
+	return func(r *redactor) {
+		r.hashKey = key
+	}
+}
+
+// RedactMiddleware replaces secrets and personal data before any handler sees
+// an entry. Values under sensitive keys are replaced whatever their type,
+// pattern matches are replaced in strings, messages and errors, causes
+// included. The fields attached to errors with WrapErr are redacted like
+// fields. Maps, structs and slices are walked and copied when something in
+// them is redacted.
+// Formatted messages are formatted first and then kept without their format
+// if anything was redacted.
+func RedactMiddleware(options ...RedactOption) Middleware {
+	r := &redactor{
+		patterns: []*regexp.Regexp{EmailPattern, CardNumberPattern, JWTPattern},
+	}
+	WithRedactKeys(DefaultRedactKeys...)(r)
+	for _, o := range options {
+		o(r)
+	}
+	if r.strategy == RedactHash && len(r.hashKey) == 0 {
+		r.hashKey = make([]byte, 32)
+		if _, err := rand.Read(r.hashKey); err != nil {
+			panic(fmt.Sprintf("xlog: generating redaction key: %v", err))
+		}
+	}
+	return func(next Closure) Closure {
+		return func(ctx context.Context, params *Params) {
+			r.redactParams(params)
+			next(ctx, params)
+		}
+	}
+}
+
+func (r *redactor) redactParams(params *Params) {
+	r.redactMessage(params)
+
+	// an earlier middleware may have shortened Fields
+	n := len(params.ContextFields)
+	if n > len(params.Fields) {
+		n = len(params.Fields)
+	}
+	ctxFields, ctxChanged := r.redactFields(params.Fields[:n])
+	fields, changed := r.redactFields(params.Fields[n:])
+	if !ctxChanged && !changed {
+		return
+	}
+	out := make([]interface{}, 0, len(ctxFields)+len(fields))
+	out = append(out, ctxFields...)
+	out = append(out, fields...)
+	params.Fields = out
+	params.ContextFields = out[:len(ctxFields):len(ctxFields)]
+}
+
+// redactMessage redacts Args in place, they belong to the entry.
+func (r *redactor) redactMessage(params *Params) {
+	changed := false
+	for i, arg := range params.Args {
+		if v, ok := r.redactValue(reflect.ValueOf(arg), 0); ok {
+			params.Args[i] = v
+			changed = true
+		}
+	}
+	if params.Format == nil {
+		return
+	}
+	msg := params.Message()
+	if red := r.redactString(msg); red != msg || changed && len(params.Args) > 0 {
+		params.Format = nil
+		params.Args = append(params.Args[:0], red)
+	}
+}
+
+// redactFields returns fields unchanged if nothing in them is sensitive, or a
+// copy with loose pairs turned into Fields.
+func (r *redactor) redactFields(fields []interface{}) ([]interface{}, bool) {
+	changed := false
+	out := make([]interface{}, 0, len(fields))
+	rangeFields(fields, func(f Field) {
+		red, ok := r.redactField(f)
+		changed = changed || ok
+		out = append(out, red)
+	})
+	if !changed {
+		return fields, false
+	}
+	return out, true
+}
+
+func (r *redactor) redactField(f Field) (Field, bool) {
+	if f.Kind == NamespaceKind {
+		return f, false
+	}
+	if r.sensitive(f.Key) {
+		return String(f.Key, r.replace(formatValue(f))), true
+	}
+	switch f.Kind {
+	case StringKind:
+		if red := r.redactString(f.Str); red != f.Str {
+			return String(f.Key, red), true
+		}
+	case ErrorKind:
+		if err, ok := r.redactError(f.Interface.(error)); ok {
+			return NamedErr(f.Key, err), true
+		}
+	case StringerKind:
+		msg := formatValue(f)
+		if red := r.redactString(msg); red != msg {
+			return String(f.Key, red), true
+		}
+	case ObjectKind, AnyKind:
+		if v, ok := r.redactValue(reflect.ValueOf(f.Interface), 0); ok {
+			return Field{Key: f.Key, Kind: f.Kind, Interface: v}, true
+		}
+	}
+	return f, false
+}
+
+// redactedError is an error whose message, causes or WrapErr fields were
+// redacted. Handlers describe it by info, which keeps the types and the stack
+// of the original. It doesn't unwrap, the causes it would reach aren't
+// redacted.
+type redactedError struct {
+	info errorInfo
+}
+
+func (e *redactedError) Error() string {
+	return e.info.Msg
+}
+
+// redactError redacts the messages of err and its causes and the fields
+// attached with WrapErr.
+func (r *redactor) redactError(err error) (error, bool) {
+	info := newErrorInfo(err)
+	changed := false
+	if red := r.redactString(info.Msg); red != info.Msg {
+		info.Msg = red
+		changed = true
+	}
+	for i, c := range info.Chain {
+		if red := r.redactString(c.Msg); red != c.Msg {
+			info.Chain[i].Msg = red
+			changed = true
+		}
+	}
+	for k, v := range info.Fields {
+		var ok bool
+		if v != nil {
+			v, ok = r.redactEntry(k, reflect.ValueOf(v), 0, false)
+		} else if r.sensitive(k) {
+			v, ok = r.replace("<nil>"), true
+		}
+		if ok {
+			info.Fields[k] = v
+			changed = true
+		}
+	}
+	if !changed {
+		return err, false
+	}
+	return &redactedError{info: info}, true
+}
+
+// redactValue returns a redacted copy of v and true, or false if nothing in v
+// needs redaction. Maps and structs are copied as map[string]interface{},
+// slices and arrays as []interface{}.
+func (r *redactor) redactValue(v reflect.Value, depth int) (interface{}, bool) {
+	if !v.IsValid() || depth > maxRedactDepth {
+		return nil, false
+	}
+	if v.CanInterface() {
+		if err, ok := v.Interface().(error); ok && v.Kind() != reflect.Struct {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return nil, false
+			}
+			msg := err.Error()
+			if red := r.redactString(msg); red != msg {
+				return red, true
+			}
+			return nil, false
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false
+		}
+		return r.redactValue(v.Elem(), depth+1)
+	case reflect.String:
+		if red := r.redactString(v.String()); red != v.String() {
+			return red, true
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, false
+		}
+		m := make(map[string]interface{}, v.Len())
+		changed := false
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key())
+			m[key], changed = r.redactEntry(key, iter.Value(), depth, changed)
+		}
+		if changed {
+			return m, true
+		}
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		changed := false
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			key := sf.Name
+			tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				key = tag
+			}
+			m[key], changed = r.redactEntry(key, v.Field(i), depth, changed)
+		}
+		if changed {
+			return m, true
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return nil, false
+		}
+		s := make([]interface{}, v.Len())
+		changed := false
+		for i := range s {
+			red, ok := r.redactValue(v.Index(i), depth+1)
+			if ok {
+				s[i] = red
+				changed = true
+			} else if v.Index(i).CanInterface() {
+				s[i] = v.Index(i).Interface()
+			}
+		}
+		if changed {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// redactEntry redacts a map or struct member, changed is carried over from
+// the previous members.
+func (r *redactor) redactEntry(key string, v reflect.Value, depth int, changed bool) (interface{}, bool) {
+	if r.sensitive(key) {
+		return r.replace(fmt.Sprint(v)), true
+	}
+	if red, ok := r.redactValue(v, depth+1); ok {
+		return red, true
+	}
+	if v.CanInterface() {
+		return v.Interface(), changed
+	}
+	return fmt.Sprint(v), changed
+}
+
+func (r *redactor) sensitive(key string) bool {
+	key = normalizeRedactKey(key)
+	for _, k := range r.keys {
+		if k != "" && strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeRedactKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', '.', ' ':
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			if re == CardNumberPattern && !cardNumber(m) {
+				return m
+			}
+			return r.replace(m)
+		})
+	}
+	return s
+}
+
+func (r *redactor) replace(s string) string {
+	switch r.strategy {
+	case RedactPartial:
+		n := utf8.RuneCountInString(s)
+		if n <= 4 {
+			return "****"
+		}
+		keep := n / 4
+		if keep > 4 {
+			keep = 4
+		}
+		runes := []rune(s)
+		return strings.Repeat("*", n-keep) + string(runes[n-keep:])
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(s))
+		return fmt.Sprintf("hmac:%x", mac.Sum(nil)[:12])
+	default:
+		return "[REDACTED]"
+	}
+}
+
+// cardPrefixes are the number ranges cards of the major networks start with:
+// Visa, Mastercard, American Express, Discover, JCB, Diners Club and
+// UnionPay.
+var cardPrefixes = []struct{ low, high string }{
+	{"4", "4"},
+	{"51", "55"}, {"2221", "2720"},
+	{"34", "34"}, {"37", "37"},
+	{"6011", "6011"}, {"644", "649"}, {"65", "65"},
+	{"3528", "3589"},
+	{"300", "305"}, {"36", "36"}, {"38", "39"},
+	{"62", "62"},
+}
+
+// cardNumber reports whether the digits of s look like a card number.
+func cardNumber(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+	for _, p := range cardPrefixes {
+		if len(digits) < len(p.low) {
+			continue
+		}
+		if prefix := digits[:len(p.low)]; prefix >= p.low && prefix <= p.high {
+			return luhn(digits)
+		}
+	}
+	return false
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,79 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestRedactShortenedFields(t *testing.T) {
+	h := &recordHandler{}
+	shorten := func(next Closure) Closure {
+		return func(ctx context.Context, params *Params) {
+			params.Fields = params.Fields[:0]
+			next(ctx, params)
+		}
+	}
+	l := newLogger(WithHandler(h), WithMiddleware(shorten, RedactMiddleware()))
+	ctx := WithFields(context.Background(), "password", "hunter2")
+	l.Info(ctx, "login")
+
+	if entries := h.Entries(); len(entries) != 1 || len(entries[0].Fields) != 0 {
+		t.Errorf("entries = %+v, want one without fields", entries)
+	}
+}
+
+func TestCardNumber(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"5500-0000-0000-0004", true},
+		{"378282246310005", true},
+		{"6011111111111117", true},
+		{"4111111111111112", false},
+		// Unix milliseconds and nanoseconds passing the Luhn check
+		{"1700000000004", false},
+		{"1700000000000000004", false},
+	} {
+		if got := cardNumber(tt.s); got != tt.want {
+			t.Errorf("cardNumber(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestRedactWrappedError(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(WithHandler(NewJSONHandler(&buf)), WithMiddleware(RedactMiddleware()))
+	cause := fmt.Errorf("login of bob@example.com: %w", io.EOF)
+	err := WrapErr(cause, "password", "hunter2", "user", "bob@example.com", "attempt", 3)
+	l.Errorv(context.Background(), Fieldsv(Err(err)))
+
+	var entry struct {
+		Error errorInfo `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %s", err, buf.Bytes())
+	}
+	got := entry.Error
+	if got.Msg != "login of [REDACTED]: EOF" || got.Type != "*fmt.wrapError" {
+		t.Errorf("error = %q of %s, want the redacted message and the original type", got.Msg, got.Type)
+	}
+	if len(got.Chain) != 1 || got.Chain[0].Msg != "EOF" || got.Chain[0].Type != "*errors.errorString" {
+		t.Errorf("chain = %+v, want EOF", got.Chain)
+	}
+	want := map[string]interface{}{"password": "[REDACTED]", "user": "[REDACTED]", "attempt": float64(3)}
+	if fmt.Sprint(got.Fields) != fmt.Sprint(want) {
+		t.Errorf("fields = %v, want %v", got.Fields, want)
+	}
+	if len(got.Stack) == 0 {
+		t.Error("the stack of WrapErr was lost")
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hunter2")) || bytes.Contains(buf.Bytes(), []byte("bob@")) {
+		t.Errorf("secret written: %s", buf.Bytes())
+	}
+}
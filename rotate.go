@@ -0,0 +1,300 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
+package xlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// timeRotator rotates a lumberjack file at fixed hours of the day on top of
+// its size limit. With a filename pattern every period gets a new file,
+// otherwise the file is rotated in place and the backup named by lumberjack.
+//
+// Lumberjack only knows the backups of the file it writes, so the files of
+// past periods are pruned and compressed by the rotator, see mill.
+type timeRotator struct {
+	mu      sync.Mutex
+	out     OutputConfig
+	every   time.Duration
+	file    *lumberjack.Logger
+	next    time.Time
+	now     func() time.Time
+	started bool
+
+	// files matches the names of the pattern and of their lumberjack backups,
+	// compressed or not, in the directory of the pattern.
+	files    *regexp.Regexp
+	millCh   chan struct{}
+	millOnce sync.Once
+}
+
+func newTimeRotator(o OutputConfig) (*timeRotator, error) {
+	hours := o.RotateEvery
+	if hours == 0 {
+		hours = 24
+	}
+	if hours < 0 || hours > 24 {
+		return nil, fmt.Errorf("xlog: rotate_every must be from 1 to 24 hours, got %d", o.RotateEvery)
+	}
+	r := &timeRotator{out: o, every: time.Duration(hours) * time.Hour, now: time.Now}
+	if o.FilenamePattern != "" {
+		if err := checkPattern(o.FilenamePattern); err != nil {
+			return nil, err
+		}
+		r.files = patternFiles(filepath.Base(o.FilenamePattern))
+	}
+	return r, nil
+}
+
+func (r *timeRotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := r.now(); !r.started || !now.Before(r.next) {
+		if err := r.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	return r.file.Write(p)
+}
+
+// Close closes the file and stops the goroutine pruning past files. Writes
+// after Close reopen the file but no longer prune.
+func (r *timeRotator) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.millCh != nil {
+		close(r.millCh)
+		r.millCh = nil
+	}
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// rotate moves to the period of now. The first call opens the file of the
+// period without rotating what a previous run left in it.
+func (r *timeRotator) rotate(now time.Time) error {
+	if !r.out.LocalTime {
+		now = now.UTC()
+	}
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	start := midnight.Add(now.Sub(midnight) / r.every * r.every)
+	r.next = start.Add(r.every)
+	if r.next.After(midnight.AddDate(0, 0, 1)) {
+		r.next = midnight.AddDate(0, 0, 1)
+	}
+
+	started := r.started
+	r.started = true
+	if r.out.FilenamePattern == "" {
+		if r.file == nil {
+			r.file = r.lumberjack(r.out.Path)
+		}
+		if !started {
+			// a file left by a run in an earlier period belongs to that period
+			if fi, err := os.Stat(r.out.Path); err != nil || !fi.ModTime().Before(start) {
+				return nil
+			}
+		}
+		return r.file.Rotate()
+	}
+	name := formatPattern(r.out.FilenamePattern, start)
+	if r.file != nil {
+		if r.file.Filename == name {
+			return nil
+		}
+		r.file.Close()
+	}
+	r.file = r.lumberjack(name)
+	if r.out.MaxAge > 0 || r.out.MaxBackups > 0 || r.out.Compress {
+		r.millOnce.Do(func() {
+			r.millCh = make(chan struct{}, 1)
+			go r.millRun(r.millCh)
+		})
+		select {
+		case r.millCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (r *timeRotator) millRun(millCh <-chan struct{}) {
+	for range millCh {
+		r.mu.Lock()
+		current := r.file.Filename
+		r.mu.Unlock()
+		r.mill(current, r.now())
+	}
+}
+
+// mill applies MaxAge, MaxBackups and Compress to the files of the periods
+// before current, like lumberjack does for its backups: the files of the
+// pattern and their size backups found next to current are all counted as
+// backups. Errors are ignored, the files are tried again at the next period.
+func (r *timeRotator) mill(current string, now time.Time) {
+	dir := filepath.Dir(current)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var old []os.FileInfo
+	for _, fi := range infos {
+		m := r.files.FindStringSubmatch(fi.Name())
+		// m[1]+m[3] is the period file a backup belongs to, the backups of the
+		// current file are left to lumberjack
+		if fi.IsDir() || m == nil || m[1]+m[3] == filepath.Base(current) {
+			continue
+		}
+		old = append(old, fi)
+	}
+	sort.Slice(old, func(i, j int) bool {
+		return old[i].ModTime().After(old[j].ModTime())
+	})
+
+	var keep []os.FileInfo
+	cutoff := now.Add(-time.Duration(r.out.MaxAge) * 24 * time.Hour)
+	for i, fi := range old {
+		if r.out.MaxBackups > 0 && i >= r.out.MaxBackups || r.out.MaxAge > 0 && fi.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, fi.Name()))
+			continue
+		}
+		keep = append(keep, fi)
+	}
+	if !r.out.Compress {
+		return
+	}
+	for _, fi := range keep {
+		if !strings.HasSuffix(fi.Name(), ".gz") {
+			compressFile(filepath.Join(dir, fi.Name()), fi)
+		}
+	}
+}
+
+// compressFile gzips name into name.gz and removes name.
+func compressFile(name string, fi os.FileInfo) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fi.Mode())
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	in.Close()
+	return os.Remove(name)
+}
+
+func (r *timeRotator) lumberjack(name string) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   name,
+		MaxSize:    r.out.MaxSize,
+		MaxAge:     r.out.MaxAge,
+		MaxBackups: r.out.MaxBackups,
+		LocalTime:  r.out.LocalTime,
+		Compress:   r.out.Compress,
+	}
+}
+
+func checkPattern(pattern string) error {
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			continue
+		}
+		i++
+		if i == len(pattern) || !strings.ContainsRune("YmdHM%", rune(pattern[i])) {
+			return fmt.Errorf("xlog: bad filename pattern %q, only %%Y, %%m, %%d, %%H, %%M and %%%% are supported", pattern)
+		}
+	}
+	return nil
+}
+
+// patternFiles returns a regexp matching the names base expands to and the
+// backups lumberjack makes of them, with .gz if compressed. The first and
+// third groups make up the name the file was written as.
+func patternFiles(base string) *regexp.Regexp {
+	ext := filepath.Ext(base)
+	return regexp.MustCompile("^(" + patternRegexp(strings.TrimSuffix(base, ext)) + ")" +
+		`(-\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}\.\d{3})?` +
+		"(" + patternRegexp(ext) + `)(\.gz)?$`)
+}
+
+func patternRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			b.WriteString(`\d{4}`)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(`\d{2}`)
+		}
+	}
+	return b.String()
+}
+
+// formatPattern expands the strftime verbs of a checked pattern.
+func formatPattern(pattern string, t time.Time) string {
+	var b strings.Builder
+	pad := func(n, width int) {
+		s := strconv.Itoa(n)
+		b.WriteString(strings.Repeat("0", width-len(s)))
+		b.WriteString(s)
+	}
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case 'Y':
+			pad(t.Year(), 4)
+		case 'm':
+			pad(int(t.Month()), 2)
+		case 'd':
+			pad(t.Day(), 2)
+		case 'H':
+			pad(t.Hour(), 2)
+		case 'M':
+			pad(t.Minute(), 2)
+		case '%':
+			b.WriteByte('%')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,162 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
+package xlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTimeRotatorMill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newTimeRotator(OutputConfig{
+		FilenamePattern: filepath.Join(dir, "app-%Y%m%d.log"),
+		MaxAge:          7,
+		MaxBackups:      2,
+		Compress:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	for name, age := range map[string]int{
+		"app-20240110.log":                         0,
+		"app-20240110-2024-01-10T11-00-00.000.log": 0,
+		"app-20240109.log":                         1,
+		"app-20240108-2024-01-08T11-00-00.000.log": 2,
+		"app-20240107.log.gz":                      3,
+		"app-20240101.log":                         9,
+		"other.log":                                20,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.AddDate(0, 0, -age)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	r.mill(filepath.Join(dir, "app-20240110.log"), now)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range infos {
+		got = append(got, fi.Name())
+	}
+	sort.Strings(got)
+	want := []string{
+		"app-20240108-2024-01-08T11-00-00.000.log.gz",
+		"app-20240109.log.gz",
+		"app-20240110-2024-01-10T11-00-00.000.log",
+		"app-20240110.log",
+		"other.log",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("files = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("files = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestTimeRotatorRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2024, 1, 10, 1, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		name        string
+		mtime       time.Time
+		wantBackups int
+	}{
+		{"yesterday", now.Add(-2 * time.Hour), 1},
+		{"today", now.Add(-time.Minute), 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".log")
+			if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			os.Chtimes(path, tt.mtime, tt.mtime)
+
+			r, err := newTimeRotator(OutputConfig{Path: path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.now = func() time.Time { return now }
+			if _, err := r.Write([]byte("new\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backups, _ := filepath.Glob(filepath.Join(dir, tt.name+"-*.log"))
+			want := "old\nnew\n"
+			if tt.wantBackups > 0 {
+				want = "new\n"
+			}
+			if string(b) != want || len(backups) != tt.wantBackups {
+				t.Errorf("file = %q with %d backups, want %q with %d", b, len(backups), want, tt.wantBackups)
+			}
+		})
+	}
+}
+
+func TestTimeRotatorClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := newTimeRotator(OutputConfig{FilenamePattern: filepath.Join(dir, "app-%Y%m%d.log"), MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	millCh := r.millCh
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// a pending trigger may still be queued before the channel reads closed
+	timeout := time.After(time.Second)
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-millCh:
+			closed = !ok
+		case <-timeout:
+			t.Fatal("Close left the pruning goroutine running")
+		}
+	}
+	// a write after Close reopens the file without pruning
+	r.next = time.Time{}
+	if _, err := r.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
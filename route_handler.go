@@ -0,0 +1,139 @@
+package xlog
+
+import (
+	"context"
+	"reflect"
+)
+
+var (
+	_ Handler = (*RouteHandler)(nil)
+	_ Syncer  = (*RouteHandler)(nil)
+	_ Closer  = (*RouteHandler)(nil)
+)
+
+// RouteMode decides how many routes of a RouteHandler an entry takes.
+type RouteMode int
+
+const (
+	// RouteAll sends an entry to every route it matches.
+	RouteAll RouteMode = iota
+	// RouteFirst sends an entry to the first route it matches only.
+	RouteFirst
+)
+
+type (
+	// Matcher selects the entries of a route.
+	Matcher func(ctx context.Context, params Params) bool
+
+	// RouteHandler dispatches entries to different handlers, e.g. ERROR and
+	// above to an errors file and a webhook, everything to stdout:
+	//
+	//	h := xlog.NewRouteHandler(xlog.RouteAll).
+	//		Route(xlog.MatchMinLevel(xlog.ERROR), errorsFile, webhook).
+	//		Route(nil, stdout)
+	RouteHandler struct {
+		mode   RouteMode
+		routes []route
+	}
+
+	route struct {
+		match    Matcher
+		handlers []Handler
+	}
+)
+
+func NewRouteHandler(mode RouteMode) *RouteHandler {
+	return &RouteHandler{mode: mode}
+}
+
+// Route adds a route in order, a nil Matcher matches every entry. Routes must
+// be added before the handler is used.
+func (h *RouteHandler) Route(match Matcher, handlers ...Handler) *RouteHandler {
+	h.routes = append(h.routes, route{match: match, handlers: handlers})
+	return h
+}
+
+func (h *RouteHandler) Log(ctx context.Context, params Params) {
+	for _, r := range h.routes {
+		if r.match != nil && !r.match(ctx, params) {
+			continue
+		}
+		for _, c := range r.handlers {
+			c.Log(ctx, params)
+		}
+		if h.mode == RouteFirst {
+			return
+		}
+	}
+}
+
+func (h *RouteHandler) Sync() error {
+	var errs multiError
+	for _, c := range h.children() {
+		if s, ok := c.(Syncer); ok {
+			errs = errs.append(s.Sync())
+		}
+	}
+	return errs.err()
+}
+
+func (h *RouteHandler) Close() error {
+	var errs multiError
+	for _, c := range h.children() {
+		switch c := c.(type) {
+		case Closer:
+			errs = errs.append(c.Close())
+		case Syncer:
+			errs = errs.append(c.Sync())
+		}
+	}
+	return errs.err()
+}
+
+// children returns every handler once, even if it is used by several routes.
+// Handlers of types that can't be compared are never merged.
+func (h *RouteHandler) children() []Handler {
+	var out []Handler
+	seen := make(map[Handler]bool)
+	for _, r := range h.routes {
+		for _, c := range r.handlers {
+			if !reflect.TypeOf(c).Comparable() {
+				out = append(out, c)
+				continue
+			}
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// MatchLevel matches entries from min to max, both included.
+func MatchLevel(min, max Level) Matcher {
+	return func(ctx context.Context, params Params) bool {
+		return params.Level >= min && params.Level <= max
+	}
+}
+
+func MatchMinLevel(min Level) Matcher {
+	return func(ctx context.Context, params Params) bool {
+		return params.Level >= min
+	}
+}
+
+// MatchField matches entries having a field key equal to value. Numbers are
+// compared after the conversions of Any, so Int and int64 values are equal.
+func MatchField(key string, value interface{}) Matcher {
+	want := Any(key, value).Value()
+	return func(ctx context.Context, params Params) bool {
+		found := false
+		rangeFields(params.Fields, func(f Field) {
+			if !found && f.Key == key && reflect.DeepEqual(f.Value(), want) {
+				found = true
+			}
+		})
+		return found
+	}
+}
@@ -0,0 +1,292 @@
+package xlog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	_ Handler = (*SamplingHandler)(nil)
+	_ Syncer  = (*SamplingHandler)(nil)
+	_ Closer  = (*SamplingHandler)(nil)
+)
+
+// SampleBy decides which entries share a sampling counter. Entries of
+// different levels never do.
+type SampleBy int
+
+const (
+	// SampleByMessage counts entries by their format, or by their message
+	// when they have none.
+	SampleByMessage SampleBy = iota
+	// SampleByCaller counts entries by the PC of their caller, entries
+	// without a caller are counted by message.
+	SampleByCaller
+)
+
+// maxSampleKeys bounds the counters kept between two summaries, idle ones are
+// forgotten beyond it.
+const maxSampleKeys = 4096
+
+type (
+	// SamplingHandler passes the first entries of each key in every interval
+	// to the wrapped handler and then one in every Thereafter. Once an
+	// interval with drops ends, one summary entry per key tells how many were
+	// dropped. Entries at PANIC or above are never dropped.
+	SamplingHandler struct {
+		next    Handler
+		sampler *sampler
+	}
+
+	SamplingOption func(*sampler)
+
+	sampler struct {
+		interval   time.Duration
+		first      uint64
+		thereafter uint64
+		by         SampleBy
+		reporter   Logger
+		report     func(ctx context.Context, params Params)
+
+		mu       sync.Mutex
+		counters map[sampleKey]*sampleCounter
+		timer    *time.Timer
+	}
+
+	sampleKey struct {
+		level Level
+		msg   string
+		pc    uintptr
+	}
+
+	sampleCounter struct {
+		start   time.Time
+		n       uint64
+		dropped uint64
+		msg     string
+		caller  *Caller
+	}
+
+	// samplerSummary marks the context of summary entries, so a sampling
+	// middleware lets them through.
+	samplerSummary struct{}
+)
+
+// WithSampleInterval sets the period counters are reset and summaries are
+// written after, 1s by default.
+func WithSampleInterval(interval time.Duration) SamplingOption {
+	return func(s *sampler) {
+		s.interval = interval
+	}
+}
+
+// WithSampleFirst sets how many entries of a key pass in each interval before
+// sampling starts, 100 by default.
+func WithSampleFirst(n int) SamplingOption {
+	return func(s *sampler) {
+		if n >= 0 {
+			s.first = uint64(n)
+		}
+	}
+}
+
+// WithSampleThereafter passes one in every n entries once the first ones of a
+// key are used up, 100 by default. 0 drops all of them.
+func WithSampleThereafter(n int) SamplingOption {
+	return func(s *sampler) {
+		if n >= 0 {
+			s.thereafter = uint64(n)
+		}
+	}
+}
+
+func WithSampleBy(by SampleBy) SamplingOption {
+	return func(s *sampler) {
+		s.by = by
+	}
+}
+
+// WithSampleReporter sets the logger SamplingMiddleware writes its summaries
+// with, the global logger by default. SamplingHandler ignores it and writes
+// them to the handler it wraps.
+func WithSampleReporter(l Logger) SamplingOption {
+	return func(s *sampler) {
+		s.reporter = l
+	}
+}
+
+func newSampler(options []SamplingOption) *sampler {
+	s := &sampler{
+		interval:   time.Second,
+		first:      100,
+		thereafter: 100,
+		counters:   make(map[sampleKey]*sampleCounter),
+	}
+	for _, o := range options {
+		o(s)
+	}
+	if s.interval <= 0 {
+		s.interval = time.Second
+	}
+	return s
+}
+
+func NewSamplingHandler(next Handler, options ...SamplingOption) *SamplingHandler {
+	h := &SamplingHandler{next: next, sampler: newSampler(options)}
+	h.sampler.report = next.Log
+	return h
+}
+
+func (h *SamplingHandler) Log(ctx context.Context, params Params) {
+	if h.sampler.sample(params) {
+		h.next.Log(ctx, params)
+	}
+}
+
+func (h *SamplingHandler) Sync() error {
+	if s, ok := h.next.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close writes the pending summaries and closes the wrapped handler.
+func (h *SamplingHandler) Close() error {
+	h.sampler.flush()
+	switch next := h.next.(type) {
+	case Closer:
+		return next.Close()
+	case Syncer:
+		return next.Sync()
+	}
+	return nil
+}
+
+// SamplingMiddleware samples entries like SamplingHandler before any handler
+// sees them. Summaries are logged by the logger of WithSampleReporter, or the
+// global one at the time they are written.
+func SamplingMiddleware(options ...SamplingOption) Middleware {
+	s := newSampler(options)
+	s.report = func(ctx context.Context, params Params) {
+		var reporter Logger = log
+		if s.reporter != nil {
+			reporter = s.reporter
+		}
+		reporter.Logv(context.WithValue(ctx, samplerSummary{}, true), params.Level, func(p *Params) {
+			p.Time = params.Time
+			p.Caller = params.Caller
+			p.Format = params.Format
+			p.Args = append(p.Args, params.Args...)
+			p.Fields = append(p.Fields, params.Fields...)
+		})
+	}
+	return func(next Closure) Closure {
+		return func(ctx context.Context, params *Params) {
+			if ctx != nil && ctx.Value(samplerSummary{}) != nil || s.sample(*params) {
+				next(ctx, params)
+				return
+			}
+			params.Drop()
+		}
+	}
+}
+
+func (s *sampler) sample(params Params) bool {
+	if params.Level >= PANIC {
+		return true
+	}
+	key := sampleKey{level: params.Level}
+	if s.by == SampleByCaller && params.Caller != nil {
+		key.pc = params.Caller.PC
+	} else if params.Format != nil {
+		key.msg = *params.Format
+	} else {
+		key.msg = params.Message()
+	}
+	now := params.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counters[key]
+	if c == nil {
+		if len(s.counters) >= maxSampleKeys {
+			s.prune(now)
+		}
+		c = &sampleCounter{start: now}
+		s.counters[key] = c
+	}
+	if now.Sub(c.start) >= s.interval {
+		c.start = now
+		c.n = 0
+	}
+	c.n++
+	if c.n <= s.first || s.thereafter > 0 && (c.n-s.first)%s.thereafter == 0 {
+		return true
+	}
+	if c.dropped == 0 {
+		c.msg = key.msg
+		if key.msg == "" {
+			c.msg = params.Message()
+		}
+		if params.Caller != nil {
+			caller := *params.Caller
+			c.caller = &caller
+		}
+	}
+	c.dropped++
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, s.flush)
+	}
+	return false
+}
+
+// prune forgets the counters without drops whose interval is over.
+func (s *sampler) prune(now time.Time) {
+	for k, c := range s.counters {
+		if c.dropped == 0 && now.Sub(c.start) >= s.interval {
+			delete(s.counters, k)
+		}
+	}
+}
+
+// flush reports the entries dropped since the last summary.
+func (s *sampler) flush() {
+	type summary struct {
+		level   Level
+		dropped uint64
+		msg     string
+		caller  *Caller
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	var summaries []summary
+	for k, c := range s.counters {
+		if c.dropped > 0 {
+			summaries = append(summaries, summary{k.level, c.dropped, c.msg, c.caller})
+			c.dropped = 0
+			c.caller = nil
+		}
+	}
+	s.prune(now)
+	s.mu.Unlock()
+
+	format := "sampled out %d log entries"
+	for _, sum := range summaries {
+		s.report(context.Background(), Params{
+			Time:   now,
+			Caller: sum.caller,
+			Level:  sum.level,
+			Format: &format,
+			Args:   []interface{}{sum.dropped},
+			Fields: []interface{}{Uint64("dropped", sum.dropped), String("sampled_message", sum.msg)},
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package xlog
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSamplingHandlerSummary(t *testing.T) {
+	next := &recordHandler{}
+	h := NewSamplingHandler(next,
+		WithSampleFirst(2), WithSampleThereafter(3), WithSampleInterval(10*time.Millisecond))
+	defer h.Close()
+
+	// the entries share an interval however slow the test runs
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		h.Log(context.Background(), Params{Time: start, Level: INFO, Args: []interface{}{"request failed"}})
+	}
+
+	entries := waitEntries(t, next, 5)
+	if len(entries) != 5 {
+		t.Fatalf("got %d entries, want the first 2, the 5th, the 8th and the summary", len(entries))
+	}
+	sum := entries[4]
+	if got := sum.Message(); got != "sampled out 6 log entries" {
+		t.Errorf("summary = %q", got)
+	}
+	if got := fieldValue(sum, "dropped"); got != uint64(6) {
+		t.Errorf("dropped = %v, want 6", got)
+	}
+	if got := fieldValue(sum, "sampled_message"); got != "request failed" {
+		t.Errorf("sampled_message = %v", got)
+	}
+	if sum.Level != INFO {
+		t.Errorf("summary level = %v, want INFO", sum.Level)
+	}
+}
+
+func TestSamplingHandlerClose(t *testing.T) {
+	next := &recordHandler{}
+	h := NewSamplingHandler(next,
+		WithSampleFirst(1), WithSampleThereafter(0), WithSampleInterval(time.Hour))
+	for i := 0; i < 3; i++ {
+		h.Log(context.Background(), Params{Level: WARNING, Args: []interface{}{"disk full"}})
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := next.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want one and the summary written by Close", len(entries))
+	}
+	if got := fieldValue(entries[1], "dropped"); got != uint64(2) {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+}
+
+func TestSamplingMiddlewareReporter(t *testing.T) {
+	global := &recordHandler{}
+	useLogger(t, WithHandler(global))
+	reported := &recordHandler{}
+	reporter := newLogger(WithHandler(reported))
+
+	h := &recordHandler{}
+	l := newLogger(WithHandler(h), WithMiddleware(SamplingMiddleware(
+		WithSampleFirst(1), WithSampleThereafter(0), WithSampleInterval(10*time.Millisecond),
+		WithSampleReporter(reporter))))
+	for i := 0; i < 5; i++ {
+		l.Error(context.Background(), "upstream down")
+	}
+	if n := len(h.Entries()); n != 1 {
+		t.Fatalf("%d entries passed, want 1", n)
+	}
+
+	entries := waitEntries(t, reported, 1)
+	if got := fieldValue(entries[0], "dropped"); got != uint64(4) || entries[0].Level != ERROR {
+		t.Errorf("summary = %v dropped=%v, want ERROR dropped=4", entries[0].Level, got)
+	}
+	if n := len(global.Entries()); n != 0 {
+		t.Errorf("the global logger got %d entries, want none", n)
+	}
+}
@@ -0,0 +1,258 @@
+//go:build go1.21
+// +build go1.21
+
+package xlog
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+var (
+	_ slog.Handler = (*slogHandler)(nil)
+	_ Handler      = (*slogAdapter)(nil)
+)
+
+// The xlog levels use the same numbers as slog, so they convert directly.
+// Records never reach PANIC and above, an slog.Handler must not panic or
+// exit, so slog levels above ERROR are logged at ERROR.
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < math.MinInt8:
+		return math.MinInt8
+	case level > slog.LevelError:
+		return ERROR
+	default:
+		return Level(level)
+	}
+}
+
+func toSlogLevel(level Level) slog.Level {
+	return slog.Level(level)
+}
+
+//------------------------------------------------------------------------------
+
+// slogHandler is an slog.Handler logging through an xlog logger.
+type slogHandler struct {
+	logger Logger
+}
+
+// NewSlogHandler returns an slog.Handler that passes records to h through an
+// xlog logger built with options, so level, context fields and middleware
+// apply as for xlog calls. Attrs become Fields and groups become Namespaces.
+func NewSlogHandler(h Handler, options ...Option) slog.Handler {
+	options = append([]Option{WithLevel(math.MinInt8)}, options...)
+	return &slogHandler{logger: NewLogger(append(options, WithHandler(h))...)}
+}
+
+func (h *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.GetLevel().Enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]interface{}, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, a)
+		return true
+	})
+	h.logger.Logv(ctx, fromSlogLevel(r.Level), func(p *Params) {
+		if !r.Time.IsZero() {
+			p.Time = r.Time
+		}
+		if r.PC != 0 {
+			p.Caller = callerFromPC(r.PC)
+		}
+		p.Args = append(p.Args, r.Message)
+		p.Fields = append(p.Fields, fields...)
+	})
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]interface{}, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, a)
+	}
+	return &slogHandler{logger: h.logger.With(fields...)}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger.With(Namespace(name))}
+}
+
+// appendSlogAttr appends a as a Field. Inline groups become nested objects,
+// groups without a key are inlined as slog requires.
+func appendSlogAttr(fields []interface{}, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key == "" {
+			for _, ga := range attrs {
+				fields = appendSlogAttr(fields, ga)
+			}
+			return fields
+		}
+		return append(fields, Object(a.Key, slogGroupMap(attrs)))
+	}
+	return append(fields, fromSlogAttr(a))
+}
+
+func slogGroupMap(attrs []slog.Attr) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() != slog.KindGroup {
+			m[a.Key] = a.Value.Any()
+			continue
+		}
+		if a.Key == "" {
+			for k, v := range slogGroupMap(a.Value.Group()) {
+				m[k] = v
+			}
+			continue
+		}
+		m[a.Key] = slogGroupMap(a.Value.Group())
+	}
+	return m
+}
+
+func fromSlogAttr(a slog.Attr) Field {
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindString:
+		return String(a.Key, v.String())
+	case slog.KindInt64:
+		return Int64(a.Key, v.Int64())
+	case slog.KindUint64:
+		return Uint64(a.Key, v.Uint64())
+	case slog.KindFloat64:
+		return Float64(a.Key, v.Float64())
+	case slog.KindBool:
+		return Bool(a.Key, v.Bool())
+	case slog.KindDuration:
+		return Duration(a.Key, v.Duration())
+	case slog.KindTime:
+		return Time(a.Key, v.Time())
+	default:
+		return Any(a.Key, v.Any())
+	}
+}
+
+func callerFromPC(pc uintptr) *Caller {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	function := frame.Function
+	if function == "" {
+		function = "???"
+	}
+	return &Caller{
+		PC:       pc,
+		File:     frame.File,
+		Filename: filepath.Base(frame.File),
+		Function: function,
+		Line:     frame.Line,
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// slogAdapter is an xlog Handler writing to an slog.Handler.
+type slogAdapter struct {
+	handler slog.Handler
+}
+
+// NewSlogAdapter returns a Handler that passes entries to h, so xlog calls end
+// up in the same sinks as slog ones. Namespace fields become slog groups.
+func NewSlogAdapter(h slog.Handler) Handler {
+	return &slogAdapter{handler: h}
+}
+
+func (a *slogAdapter) Log(ctx context.Context, params Params) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	level := toSlogLevel(params.Level)
+	if !a.handler.Enabled(ctx, level) {
+		return
+	}
+	var pc uintptr
+	if params.Caller != nil {
+		pc = params.Caller.PC
+	}
+	r := slog.NewRecord(params.Time, level, params.Message(), pc)
+
+	// attrs after a Namespace belong to its group, the groups are closed from
+	// the innermost one once all fields are collected
+	type group struct {
+		key   string
+		attrs []slog.Attr
+	}
+	groups := []group{{}}
+	rangeFields(params.Fields, func(f Field) {
+		if f.Kind == NamespaceKind {
+			groups = append(groups, group{key: f.Key})
+			return
+		}
+		g := &groups[len(groups)-1]
+		g.attrs = append(g.attrs, toSlogAttr(f))
+	})
+	for i := len(groups) - 1; i > 0; i-- {
+		attrs := make([]interface{}, len(groups[i].attrs))
+		for j, attr := range groups[i].attrs {
+			attrs[j] = attr
+		}
+		groups[i-1].attrs = append(groups[i-1].attrs, slog.Group(groups[i].key, attrs...))
+	}
+	if len(params.Stack) > 0 {
+		frames := make([]string, len(params.Stack))
+		for i, f := range params.Stack {
+			frames[i] = f.Function + " " + f.File + ":" + strconv.Itoa(f.Line)
+		}
+		groups[0].attrs = append(groups[0].attrs, slog.Any("stack", frames))
+	}
+	r.AddAttrs(groups[0].attrs...)
+	a.handler.Handle(ctx, r)
+}
+
+func toSlogAttr(f Field) slog.Attr {
+	switch f.Kind {
+	case StringKind:
+		return slog.String(f.Key, f.Str)
+	case IntKind:
+		return slog.Int64(f.Key, f.Integer)
+	case UintKind:
+		return slog.Uint64(f.Key, uint64(f.Integer))
+	case FloatKind:
+		return slog.Float64(f.Key, math.Float64frombits(uint64(f.Integer)))
+	case BoolKind:
+		return slog.Bool(f.Key, f.Integer == 1)
+	case ErrorKind:
+		info := newErrorInfo(f.Interface.(error))
+		attrs := []interface{}{slog.String("msg", info.Msg), slog.String("type", info.Type)}
+		if len(info.Chain) > 0 {
+			attrs = append(attrs, slog.Any("chain", info.Chain))
+		}
+		if len(info.Fields) > 0 {
+			attrs = append(attrs, slog.Any("fields", info.Fields))
+		}
+		if len(info.Stack) > 0 {
+			attrs = append(attrs, slog.Any("stack", info.Stack))
+		}
+		return slog.Group(f.Key, attrs...)
+	default:
+		return slog.Any(f.Key, f.Value())
+	}
+}
@@ -0,0 +1,90 @@
+//go:build go1.21
+// +build go1.21
+
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeJSONLines(t *testing.T, b []byte) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b), []byte("\n")) {
+		var m map[string]interface{}
+		if err := json.Unmarshal(line, &m); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewSlogHandler(NewJSONHandler(&buf)))
+	logger.WithGroup("req").With("id", 1).Info("handled",
+		"status", 200,
+		slog.Group("", slog.Int("inline", 2)),
+		slog.Group("empty"),
+		slog.Group("user", slog.String("name", "bob")),
+	)
+	logger.Log(context.Background(), slog.Level(100), "too high")
+
+	lines := decodeJSONLines(t, buf.Bytes())
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	want := map[string]interface{}{
+		"id":     float64(1),
+		"status": float64(200),
+		"inline": float64(2),
+		"user":   map[string]interface{}{"name": "bob"},
+	}
+	if got := lines[0]["req"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("req = %v, want %v", got, want)
+	}
+	if lines[0]["msg"] != "handled" || lines[0]["l"] != "I" {
+		t.Errorf("line = %v, want INFO handled", lines[0])
+	}
+	if c, _ := lines[0]["c"].(string); !strings.Contains(c, "/slog_test.go:") {
+		t.Errorf("caller = %q, want the record's PC in slog_test.go", c)
+	}
+	if lines[1]["l"] != "E" {
+		t.Errorf("slog level 100 logged at %v, want E", lines[1]["l"])
+	}
+}
+
+func TestSlogAdapter(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewJSONHandler(&buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+	l := newLogger(WithHandler(NewSlogAdapter(h)), WithCaller(true))
+	l.Infov(context.Background(), Args("hello"), Fieldsv(
+		String("a", "b"),
+		Namespace("req"), Int("id", 1),
+		Namespace("inner"), Bool("ok", true),
+	))
+
+	lines := decodeJSONLines(t, buf.Bytes())
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if line["msg"] != "hello" || line["level"] != "INFO" || line["a"] != "b" {
+		t.Errorf("line = %v, want INFO hello with a", line)
+	}
+	want := map[string]interface{}{"id": float64(1), "inner": map[string]interface{}{"ok": true}}
+	if !reflect.DeepEqual(line["req"], want) {
+		t.Errorf("req = %v, want %v", line["req"], want)
+	}
+	source, _ := line["source"].(map[string]interface{})
+	if file, _ := source["file"].(string); !strings.HasSuffix(file, "slog_test.go") {
+		t.Errorf("source = %v, want the xlog caller in slog_test.go", source)
+	}
+}
@@ -0,0 +1,78 @@
+package xlog
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const defaultStackDepth = 32
+
+// xlogPrefix prefixes the functions of this package, they are left out of
+// captured stacks.
+var xlogPrefix = reflect.TypeOf(logger{}).PkgPath() + "."
+
+// Stack captures the stack of the call it is passed to, up to depth frames or
+// 32 if depth isn't positive, whatever the logger's stack level.
+func Stack(depth int) Param {
+	return func(p *Params) {
+		p.Stack = captureStack(1, depth)
+	}
+}
+
+// captureStack returns up to depth frames starting skip frames above its
+// caller, like getCaller. Frames of the runtime and of xlog are skipped.
+func captureStack(skip, depth int) []Caller {
+	if depth <= 0 {
+		depth = defaultStackDepth
+	}
+	// room for the xlog and runtime frames that are dropped
+	pcs := make([]uintptr, depth+8)
+	n := runtime.Callers(skip+1, pcs)
+	return framesFromPCs(pcs[:n], depth)
+}
+
+// framesFromPCs resolves the return PCs of runtime.Callers into up to depth
+// frames, leaving out the runtime and xlog.
+func framesFromPCs(pcs []uintptr, depth int) []Caller {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	stack := make([]Caller, 0, depth)
+	for len(stack) < depth {
+		frame, more := frames.Next()
+		if frame.Function != "" && !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasPrefix(frame.Function, xlogPrefix) {
+			stack = append(stack, Caller{
+				PC:       frame.PC,
+				File:     frame.File,
+				Filename: filepath.Base(frame.File),
+				Function: frame.Function,
+				Line:     frame.Line,
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	return stack
+}
+
+// stackString formats stack like a goroutine trace, one function and one
+// indented file:line per frame.
+func stackString(stack []Caller) string {
+	var b strings.Builder
+	for i, f := range stack {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+	}
+	return b.String()
+}
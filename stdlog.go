@@ -0,0 +1,86 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	stdlog "log"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// stdLogWriter turns the output of a standard library *log.Logger into entries
+// of the global logger. The logger is set up without flags and prefix, so
+// each write is a message as it is. Flags set on it later end up in the
+// messages, the time and caller of entries come from xlog.
+type stdLogWriter struct {
+	level Level
+}
+
+// NewStdLogger returns a *log.Logger whose output is logged by the global
+// logger at level.
+func NewStdLogger(level Level) *stdlog.Logger {
+	return stdlog.New(&stdLogWriter{level: level}, "", 0)
+}
+
+// RedirectStdLog sends the output of the standard library's global logger to
+// the global logger at INFO. The returned function restores the previous
+// output, flags and prefix.
+func RedirectStdLog() func() {
+	return RedirectStdLogAt(INFO)
+}
+
+func RedirectStdLogAt(level Level) func() {
+	flags, prefix, out := stdlog.Flags(), stdlog.Prefix(), stdlog.Writer()
+	stdlog.SetFlags(0)
+	stdlog.SetPrefix("")
+	stdlog.SetOutput(&stdLogWriter{level: level})
+	return func() {
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+		stdlog.SetOutput(out)
+	}
+}
+
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimSuffix(p, []byte("\n")))
+	l := log
+	if !l.level.Load().Enabled(w.level) {
+		return len(p), nil
+	}
+	var caller *Caller
+	if l.addCaller {
+		caller = stdLogCaller()
+	}
+	l.Logv(context.Background(), w.level, func(params *Params) {
+		params.Args = append(params.Args, msg)
+		params.Caller = caller
+	})
+	return len(p), nil
+}
+
+// stdLogCaller finds the first frame above the log package that called our
+// Write. runtime.Callers returns one PC per frame, inlined ones included, so
+// each PC is resolved on its own.
+func stdLogCaller() *Caller {
+	var pcs [32]uintptr
+	n := runtime.Callers(3, pcs[:])
+	inLog := false
+	for _, pc := range pcs[:n] {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		if strings.HasPrefix(frame.Function, "log.") {
+			inLog = true
+			continue
+		}
+		if inLog {
+			return &Caller{
+				PC:       pc,
+				File:     frame.File,
+				Filename: filepath.Base(frame.File),
+				Function: frame.Function,
+				Line:     frame.Line,
+			}
+		}
+	}
+	return nil
+}
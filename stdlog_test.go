@@ -0,0 +1,25 @@
+package xlog
+
+import (
+	"testing"
+)
+
+func TestStdLoggerKeepsMessage(t *testing.T) {
+	h := &recordHandler{}
+	useLogger(t, WithHandler(h))
+	l := NewStdLogger(WARNING)
+	msgs := []string{"12:30:00 meeting starts", "2024/01/02 batch done", "main.go:12: not a header"}
+	for _, msg := range msgs {
+		l.Print(msg)
+	}
+
+	entries := h.Entries()
+	if len(entries) != len(msgs) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(msgs))
+	}
+	for i, want := range msgs {
+		if got := entries[i].Message(); got != want || entries[i].Level != WARNING {
+			t.Errorf("entry %d = %v %q, want WARNING %q", i, entries[i].Level, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package xlog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// maxWriterLine caps the length of a line logged by Writer, the rest of an
+// overlong line is discarded.
+const maxWriterLine = 64 << 10
+
+type lineWriter struct {
+	mu        sync.Mutex
+	ctx       context.Context
+	level     Level
+	fields    []interface{}
+	caller    Caller
+	buf       bytes.Buffer
+	truncated bool
+}
+
+// Writer returns an io.WriteCloser logging every line written to it as an
+// entry of the global logger at level, e.g. for the output of a child process.
+// Partial lines are buffered until their newline or Close, lines longer than
+// 64KiB are cut and marked with truncated=true. The caller of Writer is
+// reported as the caller of every entry.
+func Writer(ctx context.Context, level Level, fields ...interface{}) io.WriteCloser {
+	w := &lineWriter{ctx: ctx, level: level, fields: fields}
+	getCaller(&w.caller, 2)
+	return w
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buffer(p)
+			break
+		}
+		w.buffer(p[:i])
+		w.flush()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Close logs a pending partial line.
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 || w.truncated {
+		w.flush()
+	}
+	return nil
+}
+
+func (w *lineWriter) buffer(p []byte) {
+	if room := maxWriterLine - w.buf.Len(); len(p) > room {
+		p = p[:room]
+		w.truncated = true
+	}
+	w.buf.Write(p)
+}
+
+func (w *lineWriter) flush() {
+	line := bytes.TrimSuffix(w.buf.Bytes(), []byte("\r"))
+	msg := string(line)
+	truncated := w.truncated
+	w.buf.Reset()
+	w.truncated = false
+
+	l := log
+	l.Logv(w.ctx, w.level, func(p *Params) {
+		p.Args = append(p.Args, msg)
+		p.Fields = append(p.Fields, w.fields...)
+		if truncated {
+			p.Fields = append(p.Fields, Bool("truncated", true))
+		}
+		if l.addCaller {
+			p.Caller = &w.caller
+		}
+	})
+}
@@ -1,45 +1,191 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
 package xlog
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var (
 	_ Handler = (*zapHandler)(nil)
+	_ Syncer  = (*zapHandler)(nil)
 )
 
+var zapFieldsPool = sync.Pool{
+	New: func() interface{} {
+		fields := make([]zap.Field, 0, 16)
+		return &fields
+	},
+}
+
 type zapHandler struct {
 	logger *zap.Logger
 }
 
+// Log writes through zap.Logger directly rather than the sugared logger, fields
+// are converted with ToFields so loose pairs never hit zap's DPanic checks.
 func (h *zapHandler) Log(ctx context.Context, params Params) {
-	l := h.logger.Sugar()
-	if len(params.Fields) > 0 {
-		l = l.With(params.Fields...)
-	}
-	template := ""
-	if params.Format != nil {
-		template = *params.Format
-	}
-	switch params.Level {
-	case DEBUG:
-		l.Debugf(template, params.Args...)
-	case INFO:
-		l.Infof(template, params.Args...)
-	case WARNING:
-		l.Warnf(template, params.Args...)
-	case ERROR:
-		l.Errorf(template, params.Args...)
-	case PANIC:
-		l.Panicf(template, params.Args...)
-	case FATAL:
-		l.Fatalf(template, params.Args...)
-	default:
+	ce := h.check(params)
+	if ce == nil {
+		return
+	}
+	ce.Message = params.Message()
+	if !params.Time.IsZero() {
+		ce.Time = params.Time
+	}
+	if params.Caller != nil {
+		// prefer the xlog caller, it stays right for child loggers which are
+		// called with fewer frames than the package-level functions
+		ce.Caller = zapcore.NewEntryCaller(params.Caller.PC, params.Caller.File, params.Caller.Line, true)
+	}
+	if len(params.Stack) > 0 {
+		ce.Stack = stackString(params.Stack)
 	}
+	if len(params.Fields) == 0 {
+		ce.Write()
+		return
+	}
+	buf := zapFieldsPool.Get().(*[]zap.Field)
+	fields := (*buf)[:0]
+	rangeFields(params.Fields, func(f Field) {
+		fields = append(fields, toZapField(f))
+	})
+	ce.Write(fields...)
+	for i := range fields {
+		fields[i] = zap.Field{}
+	}
+	*buf = fields[:0]
+	zapFieldsPool.Put(buf)
+}
+
+// check goes through the core for PANIC and FATAL so zap doesn't panic or exit
+// on its own, the xlog logger does it once every handler has seen the entry.
+func (h *zapHandler) check(params Params) *zapcore.CheckedEntry {
+	lvl := toZapLevel(params.Level)
+	if lvl < zapcore.DPanicLevel {
+		return h.logger.Check(lvl, "")
+	}
+	ent := zapcore.Entry{Level: lvl, Time: params.Time}
+	return h.logger.Core().Check(ent, nil)
+}
+
+func (h *zapHandler) Sync() error {
+	return h.logger.Sync()
 }
 
 func NewZapHandler(logger *zap.Logger) Handler {
 	return &zapHandler{logger: logger}
 }
+
+// toZapLevel maps level to the nearest zap level at or below it. TRACE and
+// anything lower become debug, custom levels above ERROR stay at error so they
+// never panic or exit.
+func toZapLevel(level Level) zapcore.Level {
+	switch {
+	case level == FATAL:
+		return zapcore.FatalLevel
+	case level == PANIC:
+		return zapcore.PanicLevel
+	case level >= ERROR:
+		return zapcore.ErrorLevel
+	case level >= WARNING:
+		return zapcore.WarnLevel
+	case level >= INFO:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
+
+func toZapField(f Field) zap.Field {
+	switch f.Kind {
+	case StringKind:
+		return zap.String(f.Key, f.Str)
+	case IntKind:
+		return zap.Int64(f.Key, f.Integer)
+	case UintKind:
+		return zap.Uint64(f.Key, uint64(f.Integer))
+	case FloatKind:
+		return zap.Float64(f.Key, math.Float64frombits(uint64(f.Integer)))
+	case BoolKind:
+		return zap.Bool(f.Key, f.Integer == 1)
+	case DurationKind:
+		return zap.Duration(f.Key, time.Duration(f.Integer))
+	case TimeKind:
+		return zap.Time(f.Key, f.Interface.(time.Time))
+	case ErrorKind:
+		return zap.Object(f.Key, zapError(newErrorInfo(f.Interface.(error))))
+	case StringerKind:
+		return zap.Stringer(f.Key, f.Interface.(fmt.Stringer))
+	case ObjectKind:
+		if m, ok := f.Interface.(zapcore.ObjectMarshaler); ok {
+			return zap.Object(f.Key, m)
+		}
+		return zap.Reflect(f.Key, f.Interface)
+	case NamespaceKind:
+		return zap.Namespace(f.Key)
+	default:
+		return zap.Any(f.Key, f.Interface)
+	}
+}
+
+// zapError writes an errorInfo as a nested object, field values zap can't
+// encode are written with %+v.
+type zapError errorInfo
+
+func (e zapError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("msg", e.Msg)
+	enc.AddString("type", e.Type)
+	if len(e.Chain) > 0 {
+		enc.AddArray("chain", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, c := range e.Chain {
+				c := c
+				arr.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.AddString("msg", c.Msg)
+					enc.AddString("type", c.Type)
+					return nil
+				}))
+			}
+			return nil
+		}))
+	}
+	if len(e.Fields) > 0 {
+		enc.AddObject("fields", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			keys := make([]string, 0, len(e.Fields))
+			for k := range e.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if err := enc.AddReflected(k, e.Fields[k]); err != nil {
+					enc.AddString(k, fmt.Sprintf("%+v", e.Fields[k]))
+				}
+			}
+			return nil
+		}))
+	}
+	if len(e.Stack) > 0 {
+		enc.AddArray("stack", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			for _, f := range e.Stack {
+				f := f
+				arr.AppendObject(zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+					enc.AddString("func", f.Func)
+					enc.AddString("file", f.File)
+					enc.AddInt("line", f.Line)
+					return nil
+				}))
+			}
+			return nil
+		}))
+	}
+	return nil
+}
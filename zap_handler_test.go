@@ -0,0 +1,76 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
+package xlog
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newDiscardZap() *zap.Logger {
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(zapcore.NewCore(enc, zapcore.AddSync(ioutil.Discard), zapcore.DebugLevel))
+}
+
+// BenchmarkEnabledFields and BenchmarkRawZap write the same entry, the
+// difference is the cost of going through xlog.
+func BenchmarkEnabledFields(b *testing.B) {
+	useLogger(b, WithHandler(NewZapHandler(newDiscardZap())))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infov(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	}
+}
+
+func BenchmarkEnabledFieldsCaller(b *testing.B) {
+	useLogger(b, WithHandler(NewZapHandler(newDiscardZap())), WithCaller(true))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infov(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	}
+}
+
+func BenchmarkRawZap(b *testing.B) {
+	l := newDiscardZap()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("request handled", zap.String("path", "/users"), zap.Int("status", 200))
+	}
+}
+
+func BenchmarkRawZapCaller(b *testing.B) {
+	l := newDiscardZap().WithOptions(zap.AddCaller())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Info("request handled", zap.String("path", "/users"), zap.Int("status", 200))
+	}
+}
+
+func TestEnabledAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't stable under the race detector")
+	}
+	useLogger(t, WithHandler(NewZapHandler(newDiscardZap())))
+	raw := newDiscardZap()
+	ctx := context.Background()
+	want := testing.AllocsPerRun(100, func() {
+		raw.Info("request handled", zap.String("path", "/users"), zap.Int("status", 200))
+	})
+	got := testing.AllocsPerRun(100, func() {
+		Infov(ctx, Args("request handled"), Fieldsv(String("path", "/users"), Int("status", 200)))
+	})
+	if got > want+2 {
+		t.Errorf("enabled calls allocate %v times, raw zap %v", got, want)
+	}
+}
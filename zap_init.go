@@ -0,0 +1,142 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
+package xlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func InitDefault(cfg Config) error {
+	conf := zap.NewProductionEncoderConfig()
+	conf.TimeKey = "t"
+	conf.LevelKey = "l"
+	conf.CallerKey = "c"
+	conf.EncodeLevel = capitalLevelEncoder
+	conf.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	// outputs with a level are filtered by minLevelHandler, like the console
+	// ones written by ConsoleHandler, so custom levels compare exactly. zap
+	// cores only get the outputs' levels for the global logger.
+	var (
+		cores       []zapcore.Core
+		globalCores []zapcore.Core
+		handlers    []Handler
+		closers     outputCloser
+	)
+	for _, o := range cfg.outputs() {
+		w, c, err := openOutput(o)
+		if err != nil {
+			closers.Close()
+			return err
+		}
+		// the standard streams are unbuffered, hiding their Sync avoids the
+		// EINVAL fsync returns for terminals and pipes
+		ws := zapcore.AddSync(struct{ io.Writer }{w})
+		if c != nil {
+			closers = append(closers, c)
+			ws = zapcore.AddSync(w)
+		}
+		// cfg.Level defaults to INFO, the zero Level. The cores accept
+		// everything down to the output's level, filtering is done by the xlog
+		// level so it can be changed at runtime with SetLevel.
+		var enabler zapcore.LevelEnabler = zapcore.DebugLevel
+		if o.Level != nil {
+			enabler = toZapLevel(*o.Level)
+		}
+		switch o.Encoding {
+		case "", "json":
+			enc := zapcore.NewJSONEncoder(conf)
+			globalCores = append(globalCores, zapcore.NewCore(enc, ws, enabler))
+			core := zapcore.NewCore(enc, ws, zapcore.DebugLevel)
+			if o.Level == nil {
+				cores = append(cores, core)
+			} else {
+				handlers = append(handlers, minLevelHandler(NewZapHandler(zap.New(core)), o.Level))
+			}
+		case "console":
+			globalCores = append(globalCores, zapcore.NewCore(zapcore.NewConsoleEncoder(conf), ws, enabler))
+			handlers = append(handlers, minLevelHandler(NewConsoleHandler(w), o.Level))
+		default:
+			closers.Close()
+			return fmt.Errorf("xlog: unknown encoding %q", o.Encoding)
+		}
+	}
+
+	// the handler takes the caller from xlog, only the global zap logger looks
+	// it up itself
+	zapOptions := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(CallerSkipOffset + 1)}
+	if len(cores) > 0 {
+		zapLogger := zap.New(zapcore.NewTee(cores...))
+		handlers = append([]Handler{NewZapHandler(zapLogger)}, handlers...)
+	}
+	global := zapcore.NewTee(globalCores...)
+	// fails when every output is already stricter than cfg.Level
+	if core, err := zapcore.NewIncreaseLevelCore(global, toZapLevel(cfg.Level)); err == nil {
+		global = core
+	}
+	// the handler gets its stacks from xlog, zap only captures them for direct
+	// users of the global zap logger
+	if cfg.StackLevel != nil {
+		zapOptions = append(zapOptions, zap.AddStacktrace(toZapLevel(*cfg.StackLevel)))
+	}
+	zap.ReplaceGlobals(zap.New(global, zapOptions...))
+
+	if len(closers) > 0 {
+		handlers = append(handlers, closers)
+	}
+	return Init(append([]Option{WithHandler(handlers...)}, cfg.options()...)...)
+}
+
+func openOutput(o OutputConfig) (io.Writer, io.Closer, error) {
+	switch {
+	case o.FilenamePattern != "":
+	case o.Path == "" || o.Path == "stdout":
+		return os.Stdout, nil, nil
+	case o.Path == "stderr":
+		return os.Stderr, nil, nil
+	}
+	if o.RotateEvery != 0 || o.FilenamePattern != "" {
+		r, err := newTimeRotator(o)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r, nil
+	}
+	lj := &lumberjack.Logger{
+		Filename:   o.Path,
+		MaxSize:    o.MaxSize,
+		MaxAge:     o.MaxAge,
+		MaxBackups: o.MaxBackups,
+		LocalTime:  o.LocalTime,
+		Compress:   o.Compress,
+	}
+	return lj, lj, nil
+}
+
+func capitalLevelEncoder(lvl zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch lvl {
+	case zapcore.DebugLevel:
+		enc.AppendString("D")
+	case zapcore.InfoLevel:
+		enc.AppendString("I")
+	case zapcore.WarnLevel:
+		enc.AppendString("W")
+	case zapcore.ErrorLevel:
+		enc.AppendString("E")
+	case zapcore.DPanicLevel:
+		enc.AppendString("DP")
+	case zapcore.PanicLevel:
+		enc.AppendString("P")
+	case zapcore.FatalLevel:
+		enc.AppendString("F")
+	default:
+		enc.AppendString(fmt.Sprintf("LEVEL(%d)", lvl))
+	}
+}
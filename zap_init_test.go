@@ -0,0 +1,48 @@
+//go:build !xlog_nozap
+// +build !xlog_nozap
+
+package xlog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Outputs with a level filter custom levels exactly, whatever their encoding.
+func TestInitDefaultOutputLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	useLogger(t)
+	notice := INFO + 2
+	cfg := Config{Outputs: []OutputConfig{
+		{Path: filepath.Join(dir, "json.log"), Encoding: "json", Level: &notice},
+		{Path: filepath.Join(dir, "console.log"), Encoding: "console", Level: &notice},
+	}}
+	if err := InitDefault(cfg); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	Log(ctx, INFO+1, "below notice")
+	Log(ctx, notice, "at notice")
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"json.log", "console.log"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), "below notice") || !strings.Contains(string(b), "at notice") {
+			t.Errorf("%s = %q, want only the notice entry", name, b)
+		}
+	}
+}